@@ -1,41 +1,79 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// 保存上次全量备份目录名的状态文件，位于备份根目录中
+const lastBackupPathFile = "last_full_backup_path.txt"
+
+// 旧版本把状态文件写在当前目录，找不到新的状态文件时读取它
+const legacyLastBackupPathFile = "./last_full_backup_path.txt"
+
+// 备份过程中写出检查点的最小间隔
+const checkpointInterval = 5 * time.Second
+
+// 备份格式
+const (
+	backupFormatTar = "tar" // 每个 URI 一个 tar 文件
+	backupFormatOCI = "oci" // 整个备份目录是一个 OCI 镜像布局，blob 去重
 )
 
-// 保存上次全量备份路径的文件
-const lastBackupPathFile = "./last_full_backup_path.txt"
+// backupOptions 全量/差量/增量备份的选项
+type backupOptions struct {
+	Root   string // 备份根目录，备份目录、状态文件和备份链索引都在其中
+	Puller artifactPuller
+	Format string
+	// ChangedReposOnly 为 true 时差量/增量备份只查询基准备份之后有推送的仓库
+	ChangedReposOnly bool
+}
+
+// validate 在创建备份目录之前检查选项组合是否可用
+func (opts backupOptions) validate() error {
+	switch opts.Format {
+	case "", backupFormatTar:
+		return nil
+	case backupFormatOCI:
+		if _, ok := opts.Puller.(*nativePuller); !ok {
+			return fmt.Errorf("the %s format requires the native puller", backupFormatOCI)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown backup format: %s", opts.Format)
+	}
+}
 
 // downloadAndSaveAllArtifacts 全量备份
-func downloadAndSaveAllArtifacts(baseURL, auth string) error {
+func downloadAndSaveAllArtifacts(ctx context.Context, client *harbor.Client, opts backupOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
 	startTime := time.Now()
 	fmt.Printf("Start time: %s\n", startTime.Format("2006-01-02 15:04:05.000000000"))
 
-	// 调用 fetchAllArtifactsWithTypes 获取 URI 列表
-	artifactURIs, err := fetchAllArtifactsWithTypes(baseURL, auth)
+	// 获取需要备份的制品(即 non_unknown_arch_uris)及其仓库、tag 等信息
+	artifacts, err := fetchBackupArtifacts(ctx, client)
 	if err != nil {
 		fmt.Printf("Error fetching artifacts: %v\n", err)
 		return err
 	}
 
-	// 获取 non_unknown_arch_uris 类型的 URI 列表
-	nonUnknownArchURIs, ok := artifactURIs["non_unknown_arch_uris"]
-	if !ok {
-		fmt.Println("No non_unknown_arch_uris found.")
-		return err
-	}
+	manifest := newBackupManifest(backupTypeFull, opts.Format, client.Host(), artifacts)
+	nonUnknownArchURIs := manifest.URIs()
 
 	// 创建一个以时间戳命名的保存目录，包含 "full" 标识
 	timestamp := time.Now().Format("2006-01-02_15-04-05.000000000")
-	savePath := filepath.Join(".", "artifacts", "full_"+timestamp)
+	savePath := filepath.Join(opts.Root, "full_"+timestamp)
 	err = os.MkdirAll(savePath, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create save directory: %v", err)
@@ -48,112 +86,141 @@ func downloadAndSaveAllArtifacts(baseURL, auth string) error {
 		return fmt.Errorf("failed to save URI list: %v", err)
 	}
 
-	// 保存最新备份路径
-	err = saveLastBackupPath(savePath)
+	err = recordBackup(savePath, manifest, []string{filepath.Base(savePath)})
 	if err != nil {
-		return fmt.Errorf("failed to save last backup path: %v", err)
+		return err
 	}
 
-	// 使用带缓冲的 channel 来限制并发 goroutine 数量
-	concurrencyLimit := 5 // 并发数量限制
-	semaphore := make(chan struct{}, concurrencyLimit)
-	var wg sync.WaitGroup
-
-	for _, uri := range nonUnknownArchURIs {
-		wg.Add(1)
-		go func(uri string) {
-			defer wg.Done()
-
-			semaphore <- struct{}{}        // 获取信号量
-			defer func() { <-semaphore }() // 释放信号量
-
-			fmt.Printf("Downloading artifact: %s\n", uri)
-			cmd := exec.Command("docker", "pull", uri)
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("failed to download artifact %s: %v\nOutput: %s", uri, err, string(output))
-				return
-			}
-			fmt.Printf("Successfully downloaded artifact: %s\n", uri)
-
-			// Save the artifact to a file
-			fileName := fmt.Sprintf("%s.tar", uriToFileName(uri))
-			filePath := filepath.Join(savePath, fileName)
+	err = saveArtifactsToDir(ctx, manifest, savePath, opts)
+	if err != nil {
+		return err
+	}
 
-			fmt.Printf("Saving artifact to: %s\n", filePath)
-			saveCmd := exec.Command("docker", "save", "-o", filePath, uri)
-			saveOutput, saveErr := saveCmd.CombinedOutput()
-			if saveErr != nil {
-				fmt.Printf("failed to save artifact %s: %v\nOutput: %s", uri, saveErr, string(saveOutput))
-				return
-			}
-			fmt.Printf("Successfully saved artifact: %s\n", filePath)
-		}(uri)
+	err = recordBackup(savePath, manifest, nil)
+	if err != nil {
+		return err
+	}
+	if manifest.Status == backupStatusInterrupted {
+		return interruptedBackupError(savePath)
 	}
 
-	wg.Wait()
+	// 备份完成后才保存最新备份路径，中断的备份可以用 -resume 继续
+	err = saveLastBackupPath(opts.Root, savePath)
+	if err != nil {
+		return fmt.Errorf("failed to save last backup path: %v", err)
+	}
 
 	endTime := time.Now()
 	fmt.Printf("End time: %s\n", endTime.Format("2006-01-02 15:04:05.000000000"))
 	fmt.Printf("Duration: %s\n", endTime.Sub(startTime))
 
-	return nil
+	return checkBackupSummary(manifest)
 }
 
-// downloadAndSaveDeltaArtifactsWithDiffList 差量备份，并保存差异清单
-func downloadAndSaveDeltaArtifacts(baseURL, auth string) error {
-	startTime := time.Now()
-	fmt.Printf("Start time: %s\n", startTime.Format("2006-01-02 15:04:05.000000000"))
+// downloadAndSaveDeltaArtifacts 差量备份：与上次全量备份比较
+func downloadAndSaveDeltaArtifacts(ctx context.Context, client *harbor.Client, opts backupOptions) error {
+	// 获取上次全量备份的路径
+	lastBackupPath, err := getLastBackupPath(opts.Root)
+	if err != nil {
+		return err
+	}
+	return saveChangedArtifacts(ctx, client, opts, backupTypeDelta, []string{lastBackupPath})
+}
 
-	// 调用 fetchAllArtifactsWithTypes 获取 URI 列表
-	artifactURIs, err := fetchAllArtifactsWithTypes(baseURL, auth)
+// downloadAndSaveIncrementalArtifacts 增量备份：与上一次完成的任意类型备份比较，
+// 恢复时需要全量备份加上之后的每一个增量备份
+func downloadAndSaveIncrementalArtifacts(ctx context.Context, client *harbor.Client, opts backupOptions) error {
+	previousPath, err := latestBackupPath(opts.Root)
+	if err != nil {
+		return fmt.Errorf("no previous backup found, run full_backup first: %w", err)
+	}
+	chain, err := resolveBackupChain(previousPath)
 	if err != nil {
-		fmt.Printf("Error fetching artifacts: %v\n", err)
 		return err
 	}
+	return saveChangedArtifacts(ctx, client, opts, backupTypeIncremental, chain)
+}
 
-	// 获取 non_unknown_arch_uris 类型的 URI 列表
-	nonUnknownArchURIs, ok := artifactURIs["non_unknown_arch_uris"]
-	if !ok {
-		fmt.Println("No non_unknown_arch_uris found.")
+// saveChangedArtifacts 按 project/repo 和 digest 与 baseChain 最后一个备份时刻的状态比较，
+// 保存新增的制品，并把新增、删除和重新打 tag 的制品分别记录到 delta_changes.json
+func saveChangedArtifacts(ctx context.Context, client *harbor.Client, opts backupOptions, backupType string, baseChain []string) error {
+	if err := opts.validate(); err != nil {
 		return err
 	}
 
-	// 获取上次全量备份的路径
-	lastBackupPath, err := getLastBackupPath()
+	startTime := time.Now()
+	fmt.Printf("Start time: %s\n", startTime.Format("2006-01-02 15:04:05.000000000"))
+
+	// 读取基准备份时刻已成功保存的制品，之前失败的制品会在本次重新备份
+	basePath := baseChain[len(baseChain)-1]
+	previous, tagsKnown, err := readBackupState(baseChain)
 	if err != nil {
 		return err
 	}
 
-	// 从上次全量备份的清单文件中读取上次备份的 URI 列表
-	previousListFile := filepath.Join(lastBackupPath, "all_uri_list.txt")
-	previousURIs, err := readURIsFromFile(previousListFile)
+	// 获取需要备份的制品(即 non_unknown_arch_uris)及其仓库、tag 等信息
+	var artifacts []BackupArtifact
+	if opts.ChangedReposOnly {
+		// 基准备份中保存失败的制品也要沿用，否则没有变化的仓库中的这些制品不会被重新保存
+		known := previous
+		baseArtifacts, _, readErr := readBackupArtifacts(basePath)
+		if readErr != nil {
+			return readErr
+		}
+		for _, artifact := range baseArtifacts {
+			if artifact.Status != artifactStatusOK {
+				known = append(known, artifact)
+			}
+		}
+		artifacts, err = fetchChangedBackupArtifacts(ctx, client, known)
+	} else {
+		artifacts, err = fetchBackupArtifacts(ctx, client)
+	}
 	if err != nil {
+		fmt.Printf("Error fetching artifacts: %v\n", err)
 		return err
 	}
 
-	// 找出新的或变更的 URI
-	newOrChangedURIs := findNewOrChangedURIs(nonUnknownArchURIs, previousURIs)
-	if len(newOrChangedURIs) == 0 {
+	nonUnknownArchURIs := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		nonUnknownArchURIs = append(nonUnknownArchURIs, artifact.URI)
+	}
+
+	deltaArtifacts, changes := computeDelta(artifacts, previous, tagsKnown)
+	changes.BaseBackup = filepath.Base(basePath)
+	printDeltaChanges(changes)
+	if changes.Empty() {
 		fmt.Println("No new or changed artifacts to download.")
 		return nil
 	}
 
-	// 创建以时间戳命名的保存目录，包含 "delta" 标识
+	manifest := newBackupManifest(backupType, opts.Format, client.Host(), deltaArtifacts)
+	manifest.BaseBackup = filepath.Base(basePath)
+
+	// 创建以时间戳命名的保存目录，包含 "delta" 或 "incr" 标识
 	timestamp := time.Now().Format("2006-01-02_15-04-05.000000000")
-	savePath := filepath.Join(".", "artifacts", "delta_"+timestamp)
+	savePath := filepath.Join(opts.Root, backupDirPrefix(backupType)+timestamp)
 	err = os.MkdirAll(savePath, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create save directory: %v", err)
 	}
 
-	// 创建差异清单文件
+	// 创建差异清单文件，只包含本次保存的新增制品
+	newURIs := make([]string, 0, len(changes.Added))
+	for _, artifact := range changes.Added {
+		newURIs = append(newURIs, artifact.URI)
+	}
 	diffListFilePath := filepath.Join(savePath, "diff_list.txt")
-	err = saveURIsToFile(diffListFilePath, newOrChangedURIs)
+	err = saveURIsToFile(diffListFilePath, newURIs)
 	if err != nil {
 		return fmt.Errorf("failed to save diff URI list: %v", err)
 	}
 
+	err = writeDeltaChanges(savePath, changes)
+	if err != nil {
+		return fmt.Errorf("failed to save delta changes: %v", err)
+	}
+
 	// 创建一个清单文件
 	listFilePath := filepath.Join(savePath, "all_uri_list.txt")
 	err = saveURIsToFile(listFilePath, nonUnknownArchURIs)
@@ -161,62 +228,292 @@ func downloadAndSaveDeltaArtifacts(baseURL, auth string) error {
 		return fmt.Errorf("failed to save URI list: %v", err)
 	}
 
+	// 恢复本备份需要基准备份链上的全部目录加上它自己
+	err = recordBackup(savePath, manifest, append(chainNames(baseChain), filepath.Base(savePath)))
+	if err != nil {
+		return err
+	}
+
+	err = saveArtifactsToDir(ctx, manifest, savePath, opts)
+	if err != nil {
+		return err
+	}
+
+	err = recordBackup(savePath, manifest, nil)
+	if err != nil {
+		return err
+	}
+	if manifest.Status == backupStatusInterrupted {
+		return interruptedBackupError(savePath)
+	}
+
+	endTime := time.Now()
+	fmt.Printf("End time: %s\n", endTime.Format("2006-01-02 15:04:05.000000000"))
+	fmt.Printf("Duration: %s\n", endTime.Sub(startTime))
+
+	return checkBackupSummary(manifest)
+}
+
+// saveArtifactsToDir 并发拉取清单中 pending 状态的制品，按 opts.Format 保存到备份目录，
+// 并把每个制品的结果写回备份清单
+func saveArtifactsToDir(ctx context.Context, manifest *BackupManifest, savePath string, opts backupOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	var layout *ociLayoutWriter
+	if opts.Format == backupFormatOCI {
+		var err error
+		layout, err = newOCILayoutWriter(savePath, opts.Puller.(*nativePuller).registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeBackupManifest(savePath, manifest); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %v", err)
+	}
+
+	var manifestMutex sync.Mutex
+	lastCheckpoint := time.Now()
+
 	// 使用带缓冲的 channel 来限制并发 goroutine 数量
 	concurrencyLimit := 5 // 并发数量限制
 	semaphore := make(chan struct{}, concurrencyLimit)
 	var wg sync.WaitGroup
 
-	for _, uri := range newOrChangedURIs {
+	for i := range manifest.Artifacts {
+		if manifest.Artifacts[i].Status != artifactStatusPending {
+			continue
+		}
+
 		wg.Add(1)
-		go func(uri string) {
+		go func(artifact *BackupArtifact) {
 			defer wg.Done()
 
 			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
+			// 收到停止信号后不再开始新的制品，它们保持 pending 状态
+			if stopping(ctx) {
+				return
+			}
+
+			uri := artifact.URI
 			fmt.Printf("Downloading artifact: %s\n", uri)
-			cmd := exec.Command("docker", "pull", uri)
-			output, err := cmd.CombinedOutput()
+			var result savedFile
+			attempts, err := saveWithRetry(ctx, opts.Puller, uri, func() error {
+				var err error
+				result, err = saveArtifact(ctx, uri, savePath, layout, opts)
+				return err
+			})
+
+			manifestMutex.Lock()
+			defer manifestMutex.Unlock()
+			artifact.Attempts = attempts
+			if err != nil && stopping(ctx) {
+				// 被中止的制品不算失败，续传时重新保存
+				fmt.Printf("Stopped saving artifact %s: %v\n", uri, err)
+				return
+			}
 			if err != nil {
-				fmt.Printf("failed to download artifact %s: %v\nOutput: %s", uri, err, string(output))
+				fmt.Printf("%v\n", err)
+				artifact.Status = artifactStatusFailed
+				artifact.Error = err.Error()
 				return
 			}
-			fmt.Printf("Successfully downloaded artifact: %s\n", uri)
+			artifact.File, artifact.FileSize, artifact.SHA256 = result.File, result.FileSize, result.SHA256
+			artifact.Status = artifactStatusOK
+			artifact.Error = ""
+			fmt.Printf("Successfully saved artifact: %s\n", filepath.Join(savePath, result.File))
+
+			// 定期写出检查点，进程崩溃后 -resume 可以跳过已保存的制品
+			if time.Since(lastCheckpoint) >= checkpointInterval {
+				if err := writeCheckpoint(manifest, savePath, layout); err != nil {
+					fmt.Printf("Warning: failed to write checkpoint: %v\n", err)
+				}
+				lastCheckpoint = time.Now()
+			}
+		}(&manifest.Artifacts[i])
+	}
 
-			// Save the artifact to a file
-			fileName := fmt.Sprintf("%s.tar", uriToFileName(uri))
-			filePath := filepath.Join(savePath, fileName)
+	wg.Wait()
 
-			fmt.Printf("Saving artifact to: %s\n", filePath)
-			saveCmd := exec.Command("docker", "save", "-o", filePath, uri)
-			saveOutput, saveErr := saveCmd.CombinedOutput()
-			if saveErr != nil {
-				fmt.Printf("failed to save artifact %s: %v\nOutput: %s", uri, saveErr, string(saveOutput))
-				return
+	// 子制品保存之后再保存多架构镜像的索引，恢复时在子制品之后推送索引和它的 tag
+	if native, ok := opts.Puller.(*nativePuller); ok {
+		saveIndexes(ctx, manifest, savePath, native.registry)
+	} else if len(groupByIndex(manifest.Artifacts, func(BackupArtifact) bool { return true })) > 0 {
+		fmt.Println("WARNING: only the native puller saves the indexes of multi-arch images; " +
+			"restoring this backup pushes their platforms by digest and does NOT restore their tags")
+	}
+
+	manifest.Status = backupStatusCompleted
+	if stopping(ctx) {
+		for _, artifact := range manifest.Artifacts {
+			if artifact.Status == artifactStatusPending {
+				manifest.Status = backupStatusInterrupted
+				break
 			}
-			fmt.Printf("Successfully saved artifact: %s\n", filePath)
-		}(uri)
+		}
 	}
+	manifest.EndTime = time.Now().Format(time.RFC3339Nano)
+	return writeCheckpoint(manifest, savePath, layout)
+}
 
-	wg.Wait()
+// writeCheckpoint 先写 OCI 布局的 index.json，再写备份清单，
+// 保证清单中标记为 ok 的制品在布局中一定可以找到
+func writeCheckpoint(manifest *BackupManifest, savePath string, layout *ociLayoutWriter) error {
+	if layout != nil {
+		if err := layout.Close(); err != nil {
+			return err
+		}
+	}
+	if err := writeBackupManifest(savePath, manifest); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %v", err)
+	}
+	return nil
+}
+
+// resumeBackup 继续一个中断的全量/差量/增量备份
+// 制品列表取自备份清单，不会重新查询 Harbor；已保存且文件完好的制品会被跳过
+func resumeBackup(ctx context.Context, savePath string, opts backupOptions) error {
+	startTime := time.Now()
+	fmt.Printf("Start time: %s\n", startTime.Format("2006-01-02 15:04:05.000000000"))
+
+	manifest, err := readBackupManifest(savePath)
+	if err != nil {
+		return fmt.Errorf("cannot resume %s: %w", savePath, err)
+	}
+	if manifest.Status == backupStatusCompleted && manifest.Summary.Failed == 0 {
+		fmt.Printf("Backup %s is already completed.\n", savePath)
+		return nil
+	}
+	// 续传必须沿用原备份的格式
+	opts.Format = manifest.Format
+
+	var refs map[string]descriptor
+	if opts.Format == backupFormatOCI {
+		refs, err = readOCILayoutIndex(savePath)
+		if os.IsNotExist(err) {
+			// 还没有写出过 index.json，布局中没有可用的制品
+			refs, err = map[string]descriptor{}, nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	skipped := 0
+	for i := range manifest.Artifacts {
+		artifact := &manifest.Artifacts[i]
+		if artifact.Status == artifactStatusOK && savedFileExists(savePath, artifact, refs) {
+			skipped++
+			continue
+		}
+		artifact.Status = artifactStatusPending
+		artifact.Error = ""
+	}
+	fmt.Printf("Resuming %s: %d artifacts already saved, %d to download\n", savePath, skipped, len(manifest.Artifacts)-skipped)
+
+	manifest.Status = backupStatusInProgress
+	manifest.EndTime = ""
+	err = saveArtifactsToDir(ctx, manifest, savePath, opts)
+	if err != nil {
+		return err
+	}
+
+	err = recordBackup(savePath, manifest, nil)
+	if err != nil {
+		return err
+	}
+	if manifest.Status == backupStatusInterrupted {
+		return interruptedBackupError(savePath)
+	}
+
+	if manifest.Type == backupTypeFull {
+		err = saveLastBackupPath(opts.Root, savePath)
+		if err != nil {
+			return fmt.Errorf("failed to save last backup path: %v", err)
+		}
+	}
 
 	endTime := time.Now()
 	fmt.Printf("End time: %s\n", endTime.Format("2006-01-02 15:04:05.000000000"))
 	fmt.Printf("Duration: %s\n", endTime.Sub(startTime))
 
+	return checkBackupSummary(manifest)
+}
+
+// savedFileExists 检查清单中标记为已保存的制品在磁盘上是否仍然存在且大小一致
+func savedFileExists(savePath string, artifact *BackupArtifact, refs map[string]descriptor) bool {
+	if refs != nil {
+		if _, ok := refs[artifact.URI]; !ok {
+			return false
+		}
+	}
+	info, err := os.Stat(filepath.Join(savePath, filepath.FromSlash(artifact.File)))
+	return err == nil && info.Size() == artifact.FileSize
+}
+
+// savedFile 是单个制品保存后的文件信息
+type savedFile struct {
+	File     string // 相对于备份目录的路径
+	FileSize int64
+	SHA256   string
+}
+
+// saveArtifact 保存单个制品：tar 格式写成独立文件，oci 格式写入共享布局
+func saveArtifact(ctx context.Context, uri, savePath string, layout *ociLayoutWriter, opts backupOptions) (savedFile, error) {
+	if layout != nil {
+		desc, err := layout.Add(ctx, uri)
+		if err != nil {
+			return savedFile{}, err
+		}
+		// OCI 布局中以清单 blob 作为制品的文件，内容摘要即文件的 sha256
+		return savedFile{File: blobPath(desc.Digest), FileSize: desc.Size, SHA256: strings.TrimPrefix(desc.Digest, "sha256:")}, nil
+	}
+
+	// Save the artifact to a file
+	fileName := fmt.Sprintf("%s.tar", uriToFileName(uri))
+	filePath := filepath.Join(savePath, fileName)
+
+	if err := opts.Puller.Save(ctx, uri, filePath); err != nil {
+		return savedFile{}, err
+	}
+	sum, size, err := hashFile(filePath)
+	if err != nil {
+		return savedFile{}, fmt.Errorf("failed to hash %s: %v", filePath, err)
+	}
+	return savedFile{File: fileName, FileSize: size, SHA256: sum}, nil
+}
+
+// interruptedBackupError 返回备份被信号中断时的错误，提示用 -resume 继续
+func interruptedBackupError(savePath string) error {
+	return fmt.Errorf("backup %s was %v, continue it with -resume %s", savePath, errInterrupted, filepath.Base(savePath))
+}
+
+// checkBackupSummary 打印备份汇总，有制品失败时返回错误
+func checkBackupSummary(manifest *BackupManifest) error {
+	summary := manifest.Summary
+	fmt.Printf("Artifacts: %d total, %d saved, %d failed, %d retried, %d bytes\n",
+		summary.Total, summary.Succeeded, summary.Failed, summary.Retried, summary.TotalSize)
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d artifacts failed, see %s", summary.Failed, summary.Total, backupManifestFile)
+	}
 	return nil
 }
 
 // findNewOrChangedURIs 查找新增或更改的制品 URI
+// URI 按 project/repo@digest 比较，Harbor 地址变化不会让所有制品都变成新的
 func findNewOrChangedURIs(currentURIs, previousURIs []string) []string {
 	previousURISet := make(map[string]struct{}, len(previousURIs))
 	for _, uri := range previousURIs {
-		previousURISet[uri] = struct{}{}
+		previousURISet[uriKey(uri)] = struct{}{}
 	}
 
 	var newOrChangedURIs []string
 	for _, uri := range currentURIs {
-		if _, found := previousURISet[uri]; !found {
+		if _, found := previousURISet[uriKey(uri)]; !found {
 			// 如果这里的 uri 是切片 previousURIs 的 那么 previousURISet[uri] 肯定一直被找到
 			// 偏偏这里用的是 切片 currentURIs 的 uri 那么 能找到的都不要 找不到的留下
 			newOrChangedURIs = append(newOrChangedURIs, uri)
@@ -245,16 +542,21 @@ func saveURIsToFile(filePath string, uris []string) error {
 	return ioutil.WriteFile(filePath, []byte(data), 0644)
 }
 
-// saveLastBackupPath 保存上次备份路径到固定文件
-func saveLastBackupPath(path string) error {
-	return ioutil.WriteFile(lastBackupPathFile, []byte(path), 0644)
+// saveLastBackupPath 在备份根目录的状态文件中记录上次全量备份的目录名
+func saveLastBackupPath(root, path string) error {
+	return ioutil.WriteFile(filepath.Join(root, lastBackupPathFile), []byte(filepath.Base(path)), 0644)
 }
 
-// getLastBackupPath 获取上次备份路径
-func getLastBackupPath() (string, error) {
-	data, err := ioutil.ReadFile(lastBackupPathFile)
+// getLastBackupPath 获取上次全量备份的路径
+// 状态文件中只有目录名，旧版本记录的相对路径同样取最后一级目录名
+func getLastBackupPath(root string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(root, lastBackupPathFile))
+	if os.IsNotExist(err) {
+		data, err = ioutil.ReadFile(legacyLastBackupPathFile)
+	}
 	if err != nil {
 		return "", err
 	}
-	return string(data), nil
+	name := filepath.Base(strings.TrimSpace(string(data)))
+	return filepath.Join(root, name), nil
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 备份清单文件名，位于每个备份目录中
+const backupManifestFile = "backup_manifest.json"
+
+// 备份清单中制品的状态
+const (
+	artifactStatusPending = "pending"
+	artifactStatusOK      = "ok"
+	artifactStatusFailed  = "failed"
+)
+
+// 备份的整体状态
+const (
+	backupStatusInProgress  = "in_progress"
+	backupStatusInterrupted = "interrupted" // 收到 SIGINT/SIGTERM 后提前结束，可以用 -resume 继续
+	backupStatusCompleted   = "completed"
+)
+
+// BackupManifest 记录一次备份计划保存的全部制品及每个制品的结果
+type BackupManifest struct {
+	Version    int              `json:"version"`
+	Type       string           `json:"type"` // full 或 delta
+	Format     string           `json:"format"`
+	HarborHost string           `json:"harbor_host"`
+	BaseBackup string           `json:"base_backup,omitempty"` // 差量/增量备份所对比的基准备份目录名
+	Status     string           `json:"status,omitempty"`      // in_progress、interrupted 或 completed，旧版清单没有该字段
+	StartTime  string           `json:"start_time"`
+	EndTime    string           `json:"end_time,omitempty"`
+	Artifacts  []BackupArtifact `json:"artifacts"`
+	Summary    BackupSummary    `json:"summary"`
+}
+
+// BackupArtifact 是备份清单中的一个制品
+type BackupArtifact struct {
+	URI          string   `json:"uri"`
+	Repository   string   `json:"repository"`
+	Digest       string   `json:"digest"`
+	ParentDigest string   `json:"parent_digest,omitempty"` // 多架构制品的索引 digest
+	Platform     string   `json:"platform,omitempty"`
+	Tags         []string `json:"tags"`
+	Size         int64    `json:"size,omitempty"` // Harbor 记录的制品大小，多架构子制品没有该信息
+	PushTime     string   `json:"push_time"`
+
+	File     string `json:"file,omitempty"` // 相对于备份目录的路径
+	FileSize int64  `json:"file_size,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts,omitempty"` // 最近一次保存的尝试次数，大于 1 表示经过重试
+}
+
+// BackupSummary 备份结果汇总
+type BackupSummary struct {
+	Total     int   `json:"total"`
+	Succeeded int   `json:"succeeded"`
+	Failed    int   `json:"failed"`
+	Pending   int   `json:"pending"`
+	Retried   int   `json:"retried"`    // 经过重试的制品数(包括最终失败的)
+	TotalSize int64 `json:"total_size"` // 已保存文件的总大小
+}
+
+// newBackupManifest 创建备份清单，所有制品初始状态为 pending
+func newBackupManifest(backupType, format, harborHost string, artifacts []BackupArtifact) *BackupManifest {
+	if format == "" {
+		format = backupFormatTar
+	}
+	m := &BackupManifest{
+		Version:    1,
+		Type:       backupType,
+		Format:     format,
+		HarborHost: harborHost,
+		Status:     backupStatusInProgress,
+		StartTime:  time.Now().Format(time.RFC3339Nano),
+		Artifacts:  make([]BackupArtifact, len(artifacts)),
+	}
+	copy(m.Artifacts, artifacts)
+	for i := range m.Artifacts {
+		m.Artifacts[i].Status = artifactStatusPending
+	}
+	m.updateSummary()
+	return m
+}
+
+// updateSummary 重新统计汇总信息
+func (m *BackupManifest) updateSummary() {
+	summary := BackupSummary{Total: len(m.Artifacts)}
+	for _, artifact := range m.Artifacts {
+		if artifact.Attempts > 1 {
+			summary.Retried++
+		}
+		switch artifact.Status {
+		case artifactStatusOK:
+			summary.Succeeded++
+			summary.TotalSize += artifact.FileSize
+		case artifactStatusFailed:
+			summary.Failed++
+		default:
+			summary.Pending++
+		}
+	}
+	m.Summary = summary
+}
+
+// URIs 返回清单中的全部 URI
+func (m *BackupManifest) URIs() []string {
+	uris := make([]string, 0, len(m.Artifacts))
+	for _, artifact := range m.Artifacts {
+		uris = append(uris, artifact.URI)
+	}
+	return uris
+}
+
+// writeBackupManifest 将清单写入备份目录
+func writeBackupManifest(dir string, m *BackupManifest) error {
+	m.updateSummary()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, backupManifestFile), data)
+}
+
+// readBackupManifest 读取备份目录中的清单
+func readBackupManifest(dir string) (*BackupManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, backupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m BackupManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %v", backupManifestFile, dir, err)
+	}
+	return &m, nil
+}
+
+// readBackupArtifacts 读取备份清单中的全部制品；旧备份没有清单文件时根据 all_uri_list.txt 生成，
+// 此时制品没有 tag 信息，第二个返回值为 false
+func readBackupArtifacts(dir string) ([]BackupArtifact, bool, error) {
+	m, err := readBackupManifest(dir)
+	if err == nil {
+		return m.Artifacts, true, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, err
+	}
+
+	uris, err := readURIsFromFile(filepath.Join(dir, "all_uri_list.txt"))
+	if err != nil {
+		return nil, false, err
+	}
+	artifacts := make([]BackupArtifact, 0, len(uris))
+	for _, uri := range uris {
+		ref, err := parseArtifactURI(uri)
+		if err != nil {
+			return nil, false, err
+		}
+		artifacts = append(artifacts, BackupArtifact{URI: uri, Repository: ref.Repository, Digest: ref.Digest, Status: artifactStatusOK})
+	}
+	return artifacts, false, nil
+}
+
+// hashFile 计算文件的 sha256 和大小
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), n, nil
+}
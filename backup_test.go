@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"harbor_api_mario/harbor"
+	"harbor_api_mario/internal/fakeharbor"
+)
+
+func TestFindNewOrChangedURIs(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []string
+		previous []string
+		want     []string
+	}{
+		{"no previous backup", []string{"h/a/b@sha256:1", "h/a/b@sha256:2"}, nil, []string{"h/a/b@sha256:1", "h/a/b@sha256:2"}},
+		{"nothing changed", []string{"h/a/b@sha256:1"}, []string{"h/a/b@sha256:1"}, nil},
+		{"new digest", []string{"h/a/b@sha256:1", "h/a/b@sha256:2"}, []string{"h/a/b@sha256:1"}, []string{"h/a/b@sha256:2"}},
+		{"deleted artifacts are not new", []string{"h/a/b@sha256:1"}, []string{"h/a/b@sha256:1", "h/a/c@sha256:3"}, nil},
+		{"harbor host changed", []string{"new:8443/a/b@sha256:1"}, []string{"old/a/b@sha256:1"}, nil},
+		{"same digest in another repository", []string{"h/a/c@sha256:1"}, []string{"h/a/b@sha256:1"}, []string{"h/a/c@sha256:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findNewOrChangedURIs(tt.current, tt.previous); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findNewOrChangedURIs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// nativeBackupOptions 返回使用内置 puller 的 tar 格式备份选项
+func nativeBackupOptions(t *testing.T, client *harbor.Client) backupOptions {
+	t.Helper()
+	puller, err := newArtifactPuller("native", client)
+	if err != nil {
+		t.Fatalf("newArtifactPuller: %v", err)
+	}
+	return backupOptions{Root: t.TempDir(), Puller: puller, Format: backupFormatTar}
+}
+
+// onlyBackupDir 返回备份根目录中唯一一个以 prefix 开头的备份目录
+func onlyBackupDir(t *testing.T, root, prefix string) string {
+	t.Helper()
+	dirs, err := filepath.Glob(filepath.Join(root, prefix+"*"))
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("backup directories %s* in %s = %v, %v; want exactly one", prefix, root, dirs, err)
+	}
+	return dirs[0]
+}
+
+// readLines 读取 all_uri_list.txt 等每行一个 URI 的文件
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	lines, err := readURIsFromFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return lines
+}
+
+func TestFullBackup(t *testing.T) {
+	fake, client := newFakeHarbor(t)
+	single := fake.PushImage("library/nginx", "1.25")
+	_, children := fake.PushIndex("team/app", "v1", "linux/amd64", "linux/arm64", "unknown/unknown")
+	opts := nativeBackupOptions(t, client)
+
+	if err := downloadAndSaveAllArtifacts(context.Background(), client, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+
+	dir := onlyBackupDir(t, opts.Root, "full_")
+	wantURIs := []string{fake.URI("library/nginx", single), fake.URI("team/app", children[0]), fake.URI("team/app", children[1])}
+	if got := readLines(t, filepath.Join(dir, "all_uri_list.txt")); !reflect.DeepEqual(got, wantURIs) {
+		t.Errorf("all_uri_list.txt = %v, want %v", got, wantURIs)
+	}
+
+	manifest, err := readBackupManifest(dir)
+	if err != nil {
+		t.Fatalf("readBackupManifest: %v", err)
+	}
+	if manifest.Status != backupStatusCompleted || manifest.Summary.Succeeded != len(wantURIs) || manifest.Summary.Failed != 0 {
+		t.Fatalf("manifest status %s, summary %+v; want %d artifacts saved", manifest.Status, manifest.Summary, len(wantURIs))
+	}
+	for _, artifact := range manifest.Artifacts {
+		info, err := os.Stat(filepath.Join(dir, artifact.File))
+		if err != nil || info.Size() != artifact.FileSize {
+			t.Errorf("saved file of %s: %v (size %d, manifest says %d)", artifact.URI, err, fileSize(info), artifact.FileSize)
+		}
+	}
+
+	last, err := getLastBackupPath(opts.Root)
+	if err != nil || last != dir {
+		t.Errorf("last full backup = %s, %v; want %s", last, err, dir)
+	}
+}
+
+func TestDeltaBackup(t *testing.T) {
+	fake, client := newFakeHarbor(t)
+	fake.PushImage("library/nginx", "1.25")
+	old := fake.PushImage("library/redis", "7")
+	opts := nativeBackupOptions(t, client)
+	ctx := context.Background()
+
+	if err := downloadAndSaveAllArtifacts(ctx, client, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+
+	// 全量备份之后推送一个新镜像，删除一个旧镜像
+	added := fake.PushImage("library/nginx", "1.26")
+	fake.DeleteArtifact("library/redis", old)
+	if err := downloadAndSaveDeltaArtifacts(ctx, client, opts); err != nil {
+		t.Fatalf("delta backup: %v", err)
+	}
+
+	dir := onlyBackupDir(t, opts.Root, "delta_")
+	addedURI := fake.URI("library/nginx", added)
+	if got := readLines(t, filepath.Join(dir, "diff_list.txt")); !reflect.DeepEqual(got, []string{addedURI}) {
+		t.Errorf("diff_list.txt = %v, want only %s", got, addedURI)
+	}
+	changes, err := readDeltaChanges(dir)
+	if err != nil {
+		t.Fatalf("readDeltaChanges: %v", err)
+	}
+	if len(changes.Added) != 1 || len(changes.Removed) != 1 || changes.Removed[0].Digest != old {
+		t.Errorf("delta changes = %+v, want 1 added and %s removed", changes, old)
+	}
+	manifest, err := readBackupManifest(dir)
+	if err != nil {
+		t.Fatalf("readBackupManifest: %v", err)
+	}
+	if len(manifest.Artifacts) != 1 || manifest.Artifacts[0].URI != addedURI || manifest.Artifacts[0].Status != artifactStatusOK {
+		t.Errorf("delta manifest artifacts = %+v, want %s saved", manifest.Artifacts, addedURI)
+	}
+}
+
+func TestFullBackupWithDockerPuller(t *testing.T) {
+	fake, client := newFakeHarbor(t)
+	digest := fake.PushImage("library/nginx", "1.25")
+
+	// PATH 中的 docker 换成 shim，记录 pull 和 save 的调用
+	logPath := installRuntimeShim(t, "docker")
+	puller, err := newArtifactPuller("docker", client)
+	if err != nil {
+		t.Fatalf("newArtifactPuller: %v", err)
+	}
+	opts := backupOptions{Root: t.TempDir(), Puller: puller, Format: backupFormatTar}
+	if err := downloadAndSaveAllArtifacts(context.Background(), client, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+
+	uri := fake.URI("library/nginx", digest)
+	calls, err := fakeharbor.RuntimeCalls(logPath)
+	if err != nil {
+		t.Fatalf("RuntimeCalls: %v", err)
+	}
+	if len(calls) != 5 || calls[1] != "pull "+uri || !strings.HasPrefix(calls[2], "save -o ") || calls[4] != "rmi "+uri {
+		t.Errorf("docker calls = %q, want pull, save and rmi of %s", calls, uri)
+	}
+	// 备份拉取的镜像在保存后删除
+	if images, err := fakeharbor.RuntimeImages(logPath); err != nil || len(images) != 0 {
+		t.Errorf("local images after backup = %q, %v; want none", images, err)
+	}
+	manifest, err := readBackupManifest(onlyBackupDir(t, opts.Root, "full_"))
+	if err != nil {
+		t.Fatalf("readBackupManifest: %v", err)
+	}
+	if manifest.Summary.Succeeded != 1 {
+		t.Errorf("summary = %+v, want 1 artifact saved", manifest.Summary)
+	}
+}
+
+func fileSize(info os.FileInfo) int64 {
+	if info == nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func TestNativeBackupRetriesRequestsOnce(t *testing.T) {
+	// 每个请求最多尝试两次，等待时间很短
+	saved := defaultRetryPolicy
+	t.Cleanup(func() { defaultRetryPolicy = saved })
+	defaultRetryPolicy.MaxAttempts = 2
+	defaultRetryPolicy.BaseDelay = time.Millisecond
+
+	fake, client := newFakeHarbor(t)
+	digest := fake.PushImage("library/nginx", "1.25")
+	manifestPath := "/v2/library/nginx/manifests/" + digest
+	fake.Fail("GET", manifestPath, 10)
+
+	opts := nativeBackupOptions(t, client)
+	if err := downloadAndSaveAllArtifacts(context.Background(), client, opts); err == nil {
+		t.Fatal("full backup succeeded, want the artifact to fail")
+	}
+	// 请求层面重试一次，整个制品不再重试
+	if n := fake.Requests("GET", manifestPath); n != 2 {
+		t.Errorf("manifest GETs = %d, want 2", n)
+	}
+}
+
+func TestBackupWithTokenAuth(t *testing.T) {
+	// registry 像真实 Harbor 一样要求向 /service/token 换取 Bearer token
+	fake := fakeharbor.NewTokenAuth()
+	t.Cleanup(fake.Close)
+	client, err := harbor.NewClient(fake.BaseURL(), fake.Credentials(), harbor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	fake.PushImage("library/nginx", "1.25")
+	fake.PushImage("team/app", "v1")
+	opts := nativeBackupOptions(t, client)
+	ctx := context.Background()
+
+	if err := downloadAndSaveAllArtifacts(ctx, client, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+	// 每个仓库的 pull scope 换取一次 token，之后的清单和 blob 请求复用它
+	if n := fake.Requests("GET", "/service/token"); n != 2 {
+		t.Errorf("token requests after full backup = %d, want 2", n)
+	}
+
+	// token 被作废后，下一次请求收到 401，客户端重新换取 token
+	fake.RevokeTokens()
+	added := fake.PushImage("library/nginx", "1.26")
+	if err := downloadAndSaveDeltaArtifacts(ctx, client, opts); err != nil {
+		t.Fatalf("delta backup with revoked tokens: %v", err)
+	}
+	if n := fake.Requests("GET", "/service/token"); n != 3 {
+		t.Errorf("token requests after delta backup = %d, want 3", n)
+	}
+	manifest, err := readBackupManifest(onlyBackupDir(t, opts.Root, "delta_"))
+	if err != nil {
+		t.Fatalf("readBackupManifest: %v", err)
+	}
+	if manifest.Summary.Succeeded != 1 || manifest.Artifacts[0].Digest != added {
+		t.Errorf("delta manifest = %+v, want %s saved", manifest.Artifacts, added)
+	}
+}
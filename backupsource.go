@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// imageSource 表示备份中的一个镜像，用于恢复时读取清单和 blob
+type imageSource interface {
+	// Manifest 返回要推送的清单原文、描述符和解析结果
+	Manifest() ([]byte, descriptor, *imageManifest)
+	// OpenBlob 每次调用都返回从头开始的 blob 内容
+	OpenBlob(digest string) (io.Reader, error)
+	Close() error
+}
+
+// tarImageSource 读取单个镜像 tar(本工具的 native 输出或 docker save 输出)
+type tarImageSource struct {
+	f       *os.File
+	entries map[string]*io.SectionReader // tar 内文件名 -> 内容
+	blobs   map[string]string            // digest -> tar 内文件名
+
+	manifestBytes []byte
+	manifestDesc  descriptor
+	manifest      *imageManifest
+	// Rebuilt 表示清单是根据 docker save 的 manifest.json 重新生成的，digest 与原制品不同
+	Rebuilt bool
+}
+
+// openTarImageSource 扫描 tar 建立索引，优先使用 tar 中的 OCI 清单，否则根据 manifest.json 重新生成
+func openTarImageSource(filePath string) (*tarImageSource, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &tarImageSource{f: f, entries: make(map[string]*io.SectionReader), blobs: make(map[string]string)}
+	if err := s.index(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading %s: %v", filePath, err)
+	}
+
+	if _, ok := s.entries["index.json"]; ok {
+		err = s.loadOCIManifest()
+	} else {
+		err = s.rebuildManifest()
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading %s: %v", filePath, err)
+	}
+	return s, nil
+}
+
+// index 记录每个文件在 tar 中的偏移量，之后可以随机读取
+func (s *tarImageSource) index() error {
+	// docker save 对重复的层使用符号链接，扫描完成后再解析
+	links := make(map[string]string)
+	tr := tar.NewReader(s.f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			links[path.Clean(hdr.Name)] = path.Join(path.Dir(hdr.Name), hdr.Linkname)
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// archive/tar 不做预读，此时文件位置就是内容的起始位置
+		offset, err := s.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		s.entries[path.Clean(hdr.Name)] = io.NewSectionReader(s.f, offset, hdr.Size)
+	}
+
+	for name, target := range links {
+		if entry, ok := s.entries[target]; ok {
+			s.entries[name] = entry
+		}
+	}
+	return nil
+}
+
+func (s *tarImageSource) readEntry(name string) ([]byte, error) {
+	entry, ok := s.entries[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	return ioutil.ReadAll(io.NewSectionReader(entry, 0, entry.Size()))
+}
+
+// loadOCIManifest 读取 index.json 引用的镜像清单
+func (s *tarImageSource) loadOCIManifest() error {
+	data, err := s.readEntry("index.json")
+	if err != nil {
+		return err
+	}
+	var index imageIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("invalid index.json: %v", err)
+	}
+	if len(index.Manifests) == 0 {
+		return fmt.Errorf("index.json has no manifests")
+	}
+
+	desc := index.Manifests[0]
+	manifestBytes, err := s.readEntry(blobPath(desc.Digest))
+	if err != nil {
+		return err
+	}
+	var m imageManifest
+	if err := json.Unmarshal(manifestBytes, &m); err != nil {
+		return fmt.Errorf("invalid manifest %s: %v", desc.Digest, err)
+	}
+
+	for name := range s.entries {
+		if dir, file := path.Split(name); dir == "blobs/sha256/" {
+			s.blobs["sha256:"+file] = name
+		}
+	}
+	desc.Annotations = nil
+	s.manifestBytes, s.manifestDesc, s.manifest = manifestBytes, desc, &m
+	return nil
+}
+
+// rebuildManifest 为旧版 docker save 输出(只有 manifest.json)生成 docker v2 清单
+func (s *tarImageSource) rebuildManifest() error {
+	data, err := s.readEntry("manifest.json")
+	if err != nil {
+		return err
+	}
+	var entries []struct {
+		Config string
+		Layers []string
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid manifest.json: %v", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("manifest.json is empty")
+	}
+
+	config, err := s.describeEntry(entries[0].Config, "application/vnd.docker.container.image.v1+json")
+	if err != nil {
+		return err
+	}
+	m := imageManifest{SchemaVersion: 2, MediaType: mediaTypeDockerManifest, Config: config}
+	for _, layer := range entries[0].Layers {
+		desc, err := s.describeEntry(layer, "")
+		if err != nil {
+			return err
+		}
+		m.Layers = append(m.Layers, desc)
+	}
+
+	manifestBytes, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	s.manifestBytes, s.manifest, s.Rebuilt = manifestBytes, &m, true
+	s.manifestDesc = descriptor{MediaType: mediaTypeDockerManifest, Digest: sha256Digest(manifestBytes), Size: int64(len(manifestBytes))}
+	return nil
+}
+
+// describeEntry 计算 tar 内文件的摘要；mediaType 为空时按是否 gzip 压缩判断层类型
+func (s *tarImageSource) describeEntry(name, mediaType string) (descriptor, error) {
+	entry, ok := s.entries[path.Clean(name)]
+	if !ok {
+		return descriptor{}, fmt.Errorf("missing %s", name)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(entry, 0, entry.Size()))
+	if mediaType == "" {
+		mediaType = "application/vnd.docker.image.rootfs.diff.tar"
+		if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			mediaType = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+		}
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return descriptor{}, err
+	}
+	digest := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+	s.blobs[digest] = path.Clean(name)
+	return descriptor{MediaType: mediaType, Digest: digest, Size: entry.Size()}, nil
+}
+
+func (s *tarImageSource) Manifest() ([]byte, descriptor, *imageManifest) {
+	return s.manifestBytes, s.manifestDesc, s.manifest
+}
+
+func (s *tarImageSource) OpenBlob(digest string) (io.Reader, error) {
+	name, ok := s.blobs[digest]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found in archive", digest)
+	}
+	entry := s.entries[name]
+	return io.NewSectionReader(entry, 0, entry.Size()), nil
+}
+
+func (s *tarImageSource) Close() error {
+	return s.f.Close()
+}
+
+// ociLayoutImageSource 读取 OCI 布局备份目录中的一个镜像
+type ociLayoutImageSource struct {
+	dir           string
+	manifestBytes []byte
+	manifestDesc  descriptor
+	manifest      *imageManifest
+}
+
+// readOCILayoutIndex 读取 OCI 布局的 index.json，返回 URI -> 清单描述符
+func readOCILayoutIndex(dir string) (map[string]descriptor, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index imageIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid index.json in %s: %v", dir, err)
+	}
+	refs := make(map[string]descriptor, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		if name := desc.Annotations["org.opencontainers.image.ref.name"]; name != "" {
+			refs[name] = desc
+		}
+	}
+	return refs, nil
+}
+
+// openOCILayoutImageSource 打开布局中 desc 指向的镜像
+func openOCILayoutImageSource(dir string, desc descriptor) (*ociLayoutImageSource, error) {
+	manifestBytes, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(blobPath(desc.Digest))))
+	if err != nil {
+		return nil, err
+	}
+	var m imageManifest
+	if err := json.Unmarshal(manifestBytes, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", desc.Digest, err)
+	}
+	desc.Annotations = nil
+	return &ociLayoutImageSource{dir: dir, manifestBytes: manifestBytes, manifestDesc: desc, manifest: &m}, nil
+}
+
+func (s *ociLayoutImageSource) Manifest() ([]byte, descriptor, *imageManifest) {
+	return s.manifestBytes, s.manifestDesc, s.manifest
+}
+
+// OpenBlob 返回的 *os.File 由 http.Client 在请求结束后关闭
+func (s *ociLayoutImageSource) OpenBlob(digest string) (io.Reader, error) {
+	return os.Open(filepath.Join(s.dir, filepath.FromSlash(blobPath(digest))))
+}
+
+func (s *ociLayoutImageSource) Close() error {
+	return nil
+}
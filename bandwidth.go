@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 所有制品下载共用的带宽限制，nil 表示不限制；main 根据 -max-bandwidth、-bandwidth-schedule 设置
+var downloadLimiter *bandwidthLimiter
+
+// bandwidthLimiter 限制所有并发下载的总带宽，可以只在指定的时间段内生效
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+	schedule       []timeWindow // 为空表示任何时间都限制
+
+	mu   sync.Mutex
+	next time.Time // 已预约的字节全部发送完的时间
+}
+
+// timeWindow 是一个本地时间段，End 早于 Start 时跨过午夜
+type timeWindow struct {
+	Days  [7]bool // 按 time.Weekday 下标，全部为 false 表示每天
+	Start int     // 从 0 点开始的分钟数
+	End   int
+}
+
+// newBandwidthLimiter 解析 -max-bandwidth 和 -bandwidth-schedule，limit 为空时返回 nil
+func newBandwidthLimiter(limit, schedule string) (*bandwidthLimiter, error) {
+	if limit == "" {
+		if schedule != "" {
+			return nil, fmt.Errorf("--bandwidth-schedule needs --max-bandwidth")
+		}
+		return nil, nil
+	}
+	rate, err := parseBandwidth(limit)
+	if err != nil {
+		return nil, err
+	}
+	windows, err := parseBandwidthSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &bandwidthLimiter{bytesPerSecond: rate, schedule: windows}, nil
+}
+
+// parseBandwidth 解析如 200MB/s、512KiB/s、1G 的带宽，KB/MB/GB 按 1000 进位，KiB/MiB/GiB 按 1024 进位
+func parseBandwidth(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.TrimSpace(value), "/s")
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	number, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q, use e.g. 200MB/s", value)
+	}
+	units := map[string]float64{
+		"": 1, "b": 1,
+		"k": 1e3, "kb": 1e3, "kib": 1 << 10,
+		"m": 1e6, "mb": 1e6, "mib": 1 << 20,
+		"g": 1e9, "gb": 1e9, "gib": 1 << 30,
+	}
+	unit, ok := units[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid bandwidth unit in %q, use B, KB, MB, GB, KiB, MiB or GiB", value)
+	}
+	return int64(number * unit), nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseBandwidthSchedule 解析逗号分隔的时间段，如 "mon-fri 08:00-19:00,sat 10:00-14:00"，星期可以省略
+func parseBandwidthSchedule(schedule string) ([]timeWindow, error) {
+	var windows []timeWindow
+	for _, entry := range splitList(schedule) {
+		var window timeWindow
+		days, hours, found := strings.Cut(entry, " ")
+		if !found {
+			days, hours = "", entry
+		}
+		if days != "" {
+			first, last, isRange := strings.Cut(strings.ToLower(days), "-")
+			if !isRange {
+				last = first
+			}
+			from, ok1 := weekdays[first]
+			to, ok2 := weekdays[last]
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("invalid days %q in bandwidth schedule, use e.g. mon-fri", days)
+			}
+			for d := from; ; d = (d + 1) % 7 {
+				window.Days[d] = true
+				if d == to {
+					break
+				}
+			}
+		}
+		start, end, ok := strings.Cut(strings.TrimSpace(hours), "-")
+		var err1, err2 error
+		window.Start, err1 = parseClock(start)
+		window.End, err2 = parseClock(end)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid time range %q in bandwidth schedule, use e.g. 08:00-19:00", hours)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// parseClock 把 HH:MM 转换为从 0 点开始的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains 判断时间点是否在时间段内；跨午夜的时间段按开始那天的星期判断
+func (w timeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case w.Start < w.End:
+		if minute < w.Start || minute >= w.End {
+			return false
+		}
+	case w.Start > w.End:
+		if minute < w.End {
+			day = (day + 6) % 7 // 午夜之后属于前一天开始的时间段
+		} else if minute < w.Start {
+			return false
+		}
+	}
+	allDays := w.Days == [7]bool{}
+	return allDays || w.Days[day]
+}
+
+// active 返回当前时间是否需要限速
+func (l *bandwidthLimiter) active(now time.Time) bool {
+	if len(l.schedule) == 0 {
+		return true
+	}
+	for _, window := range l.schedule {
+		if window.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitN 为 n 个字节预约带宽并等待到可以继续读取
+func (l *bandwidthLimiter) waitN(ctx context.Context, n int) error {
+	now := time.Now()
+	if !l.active(now) {
+		return nil
+	}
+	l.mu.Lock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSecond) * float64(time.Second)))
+	l.mu.Unlock()
+	return sleepContext(ctx, wait)
+}
+
+// throttleDownload 在设置了带宽限制时包装下载的响应体
+func throttleDownload(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	if downloadLimiter == nil {
+		return body
+	}
+	return &throttledReader{ReadCloser: body, ctx: ctx, limiter: downloadLimiter}
+}
+
+// throttledReader 每次读取之前按读取的字节数等待带宽
+type throttledReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *bandwidthLimiter
+}
+
+// 单次读取的上限，避免一次预约过多字节导致速率抖动
+const throttleChunkSize = 32 * 1024
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.waitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
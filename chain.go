@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 备份类型，同时决定备份目录名的前缀
+const (
+	backupTypeFull        = "full"        // full_<时间戳>
+	backupTypeDelta       = "delta"       // delta_<时间戳>，相对上次全量备份的差异
+	backupTypeIncremental = "incremental" // incr_<时间戳>，相对上一次任意备份的差异
+)
+
+// 备份链索引文件，位于备份根目录中
+const backupIndexFile = "backup_index.json"
+
+// BackupIndex 记录根目录下每个备份以及恢复它所需的备份链
+type BackupIndex struct {
+	Backups []BackupIndexEntry `json:"backups"`
+}
+
+// BackupIndexEntry 是备份链索引中的一个备份
+type BackupIndexEntry struct {
+	Name      string   `json:"name"` // 备份目录名
+	Type      string   `json:"type"`
+	Base      string   `json:"base,omitempty"` // 比较的基准备份目录名
+	Chain     []string `json:"chain"`          // 恢复该备份需要的目录名，从全量备份开始，最后是它自己
+	Status    string   `json:"status"`
+	StartTime string   `json:"start_time"`
+	EndTime   string   `json:"end_time,omitempty"`
+}
+
+// backupDirPrefix 返回备份类型对应的目录名前缀
+func backupDirPrefix(backupType string) string {
+	if backupType == backupTypeIncremental {
+		return "incr_"
+	}
+	return backupType + "_"
+}
+
+// readBackupIndex 读取备份根目录中的索引，文件不存在时返回空索引
+func readBackupIndex(root string) (*BackupIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(root, backupIndexFile))
+	if os.IsNotExist(err) {
+		return &BackupIndex{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index BackupIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %v", backupIndexFile, root, err)
+	}
+	return &index, nil
+}
+
+// writeBackupIndex 写出索引，条目按目录名(即时间顺序)排序
+func writeBackupIndex(root string, index *BackupIndex) error {
+	sort.Slice(index.Backups, func(i, j int) bool {
+		return backupTimestamp(index.Backups[i].Name) < backupTimestamp(index.Backups[j].Name)
+	})
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(root, backupIndexFile), data)
+}
+
+// find 按目录名查找备份，找不到时返回 nil
+func (index *BackupIndex) find(name string) *BackupIndexEntry {
+	for i := range index.Backups {
+		if index.Backups[i].Name == name {
+			return &index.Backups[i]
+		}
+	}
+	return nil
+}
+
+// backupTimestamp 返回目录名中的时间戳部分，可以直接按字符串比较先后
+func backupTimestamp(name string) string {
+	if i := strings.Index(name, "_"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// recordBackup 在备份根目录的索引中登记或更新一个备份
+// chain 为空时保留索引中已有的备份链(用于续传)
+func recordBackup(savePath string, manifest *BackupManifest, chain []string) error {
+	root, name := filepath.Dir(savePath), filepath.Base(savePath)
+	index, err := readBackupIndex(root)
+	if err != nil {
+		return err
+	}
+
+	entry := index.find(name)
+	if entry == nil {
+		index.Backups = append(index.Backups, BackupIndexEntry{Name: name})
+		entry = &index.Backups[len(index.Backups)-1]
+	}
+	entry.Type = manifest.Type
+	if manifest.BaseBackup != "" {
+		entry.Base = filepath.Base(manifest.BaseBackup)
+	}
+	if len(chain) > 0 {
+		entry.Chain = chain
+	}
+	if len(entry.Chain) == 0 {
+		entry.Chain = []string{name}
+	}
+	entry.Status = manifest.Status
+	entry.StartTime = manifest.StartTime
+	entry.EndTime = manifest.EndTime
+
+	if err := writeBackupIndex(root, index); err != nil {
+		return fmt.Errorf("failed to write %s: %v", backupIndexFile, err)
+	}
+	return nil
+}
+
+// latestBackupPath 返回根目录下最近一次完成的备份(任意类型)
+// 还没有索引的旧目录回退到上次全量备份
+func latestBackupPath(root string) (string, error) {
+	index, err := readBackupIndex(root)
+	if err != nil {
+		return "", err
+	}
+	for i := len(index.Backups) - 1; i >= 0; i-- {
+		if index.Backups[i].Status == backupStatusCompleted {
+			return filepath.Join(root, index.Backups[i].Name), nil
+		}
+	}
+	return getLastBackupPath(root)
+}
+
+// chainNames 把备份链中的路径转换为目录名
+func chainNames(chain []string) []string {
+	names := make([]string, 0, len(chain))
+	for _, dir := range chain {
+		names = append(names, filepath.Base(dir))
+	}
+	return names
+}
+
+// readBackupState 重建备份链最后一个备份时刻已备份的制品：
+// 从全量备份中已保存的制品开始，依次应用每个差量/增量备份的 delta_changes.json 和新保存的制品。
+// 第二个返回值表示 tag 信息是否完整(旧备份没有清单时为 false)
+func readBackupState(chain []string) ([]BackupArtifact, bool, error) {
+	state := make(map[string]BackupArtifact)
+	tagsKnown := true
+
+	for i, dir := range chain {
+		if i > 0 {
+			changes, err := readDeltaChanges(dir)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, false, err
+			}
+			if err == nil {
+				for _, artifact := range changes.Removed {
+					delete(state, artifactKey(artifact.Repository, artifact.Digest))
+				}
+				for _, artifact := range changes.Retagged {
+					key := artifactKey(artifact.Repository, artifact.Digest)
+					if old, ok := state[key]; ok {
+						old.Tags = artifact.Tags
+						state[key] = old
+					}
+				}
+			} else {
+				// 旧版差量备份没有变化记录，以它的 all_uri_list.txt 为准
+				uris, err := readURIsFromFile(filepath.Join(dir, "all_uri_list.txt"))
+				if err != nil {
+					return nil, false, err
+				}
+				current := make(map[string]bool, len(uris))
+				for _, uri := range uris {
+					current[uriKey(uri)] = true
+				}
+				for key := range state {
+					if !current[key] {
+						delete(state, key)
+					}
+				}
+			}
+		}
+
+		artifacts, known, err := readBackupArtifacts(dir)
+		if err != nil {
+			return nil, false, err
+		}
+		tagsKnown = tagsKnown && known
+		for _, artifact := range artifacts {
+			if artifact.Status == artifactStatusOK {
+				state[artifactKey(artifact.Repository, artifact.Digest)] = artifact
+			}
+		}
+	}
+
+	artifacts := make([]BackupArtifact, 0, len(state))
+	for _, artifact := range state {
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].URI < artifacts[j].URI })
+	return artifacts, tagsKnown, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 默认的备份根目录(相对于当前目录)
+const defaultBackupRoot = "artifacts"
+
+// fileConfig 是 -config / HARBOR_CONFIG 指定的 JSON 配置文件
+type fileConfig struct {
+	// BackupRoot 备份根目录，相对路径相对于配置文件所在目录
+	BackupRoot string `json:"backup_root"`
+
+	// HTTP 客户端设置，与同名命令行参数含义相同，文件路径相对于配置文件所在目录
+	Timeout    string `json:"timeout"` // 如 "60s"、"2m"
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	Insecure   bool   `json:"insecure"`
+	Proxy      string `json:"proxy"`
+
+	// Harbor API 限流，见 -api-rps、-api-max-in-flight
+	APIRequestsPerSecond float64 `json:"api_rps"`
+	APIMaxInFlight       int     `json:"api_max_in_flight"`
+
+	// 同时查询的项目或仓库数，见 -crawl-concurrency
+	CrawlConcurrency int `json:"crawl_concurrency"`
+
+	// 清单缓存文件，见 -cache-file
+	CacheFile string `json:"cache_file"`
+
+	// 制品下载的总带宽限制，见 -max-bandwidth、-bandwidth-schedule
+	MaxBandwidth      string `json:"max_bandwidth"`      // 如 "200MB/s"
+	BandwidthSchedule string `json:"bandwidth_schedule"` // 如 "mon-fri 08:00-19:00"
+
+	// 凭据文件和 docker config.json，见 -credentials-file、-docker-config
+	CredentialsFile string `json:"credentials_file"`
+	DockerConfig    string `json:"docker_config"`
+}
+
+// loadConfig 读取配置文件，path 为空时返回空配置
+func loadConfig(path string) (*fileConfig, error) {
+	cfg := &fileConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	for _, value := range []*string{&cfg.BackupRoot, &cfg.CACert, &cfg.ClientCert, &cfg.ClientKey, &cfg.CredentialsFile, &cfg.DockerConfig, &cfg.CacheFile} {
+		if *value != "" && !filepath.IsAbs(*value) {
+			*value = filepath.Join(filepath.Dir(path), *value)
+		}
+	}
+	return cfg, nil
+}
+
+// resolveBackupRoot 按 命令行参数 > HARBOR_BACKUP_ROOT > 配置文件 > 默认值 的顺序确定备份根目录，
+// 返回绝对路径，之后切换工作目录也不会影响备份位置
+func resolveBackupRoot(flagValue string, cfg *fileConfig) (string, error) {
+	root := defaultBackupRoot
+	for _, value := range []string{flagValue, os.Getenv("HARBOR_BACKUP_ROOT"), cfg.BackupRoot} {
+		if value != "" {
+			root = value
+			break
+		}
+	}
+	return filepath.Abs(root)
+}
+
+// resolveBackupDir 只给出目录名(如 full_2024-01-07_02-00-00.000000000)时在备份根目录中查找
+func resolveBackupDir(root, dir string) string {
+	if dir == "" || strings.ContainsRune(dir, filepath.Separator) || strings.Contains(dir, "/") {
+		return dir
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	return filepath.Join(root, dir)
+}
+
+// resolveInventoryCachePath 按 命令行参数 > 配置文件 > 备份根目录中的 inventory_cache.json 的顺序确定清单缓存文件
+func resolveInventoryCachePath(flagValue, root string, cfg *fileConfig) string {
+	for _, value := range []string{flagValue, cfg.CacheFile} {
+		if value != "" {
+			return value
+		}
+	}
+	return filepath.Join(root, inventoryCacheFile)
+}
+
+// resolveHTTPClientOptions 合并命令行参数和配置文件中的 HTTP 客户端设置，命令行参数优先
+func resolveHTTPClientOptions(opts httpClientOptions, cfg *fileConfig) (httpClientOptions, error) {
+	if opts.Timeout == 0 && cfg.Timeout != "" {
+		timeout, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout %q in config file: %v", cfg.Timeout, err)
+		}
+		opts.Timeout = timeout
+	}
+	if opts.CAFile == "" {
+		opts.CAFile = cfg.CACert
+	}
+	if opts.CertFile == "" && opts.KeyFile == "" {
+		opts.CertFile, opts.KeyFile = cfg.ClientCert, cfg.ClientKey
+	}
+	if opts.Proxy == "" {
+		opts.Proxy = cfg.Proxy
+	}
+	opts.Insecure = opts.Insecure || cfg.Insecure
+	if opts.APIRequestsPerSecond == 0 {
+		opts.APIRequestsPerSecond = cfg.APIRequestsPerSecond
+	}
+	if opts.APIMaxInFlight == 0 {
+		opts.APIMaxInFlight = cfg.APIMaxInFlight
+	}
+	return opts, nil
+}
+
+// resolveBandwidthLimiter 合并命令行参数和配置文件中的带宽限制，命令行参数优先；没有限制时返回 nil
+func resolveBandwidthLimiter(limit, schedule string, cfg *fileConfig) (*bandwidthLimiter, error) {
+	if limit == "" {
+		limit = cfg.MaxBandwidth
+	}
+	if schedule == "" {
+		schedule = cfg.BandwidthSchedule
+	}
+	return newBandwidthLimiter(limit, schedule)
+}
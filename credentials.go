@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"harbor_api_mario/harbor"
+)
+
+// credentials 访问 Harbor API 和 registry 的凭据及其来源
+type credentials struct {
+	harbor.Credentials
+	source string // 凭据来源，用于错误提示
+}
+
+// normalize 补全认证方式和 robot 前缀，并检查必填字段
+func (c *credentials) normalize() error {
+	if err := c.Credentials.Normalize(); err != nil {
+		return fmt.Errorf("%s: %v", c.source, err)
+	}
+	return nil
+}
+
+// credentialsFromAuth 解析 HARBOR_AUTH 格式的凭据：base64 编码的 user:password，
+// 或者完整的 Authorization 头，如 "Basic <base64>"、"Bearer <token>"
+func credentialsFromAuth(auth, source string) (*credentials, error) {
+	if scheme, value, ok := strings.Cut(auth, " "); ok {
+		if strings.EqualFold(scheme, "bearer") {
+			return &credentials{Credentials: harbor.Credentials{Type: harbor.AuthTypeBearer, Token: value}, source: source}, nil
+		}
+		auth = value
+	}
+	return decodeBasicAuth(auth, source)
+}
+
+// decodeBasicAuth 解码 base64 编码的 user:password(旧的 HARBOR_AUTH 和 docker config.json 中的 auth)
+func decodeBasicAuth(encoded, source string) (*credentials, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid base64 credentials: %v", source, err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, fmt.Errorf("%s: credentials must be base64 encoded user:password", source)
+	}
+	return &credentials{Credentials: harbor.Credentials{Type: harbor.AuthTypeBasic, Username: username, Password: password}, source: source}, nil
+}
+
+// resolveCredentials 按 环境变量 > 凭据文件 > docker config.json 的顺序查找访问 baseURL 的凭据，
+// 都没有时返回 nil
+func resolveCredentials(baseURL, credentialsFile, dockerConfig string) (*credentials, error) {
+	creds, err := credentialsFromEnv()
+	if creds == nil && err == nil && credentialsFile != "" {
+		creds, err = loadCredentialsFile(credentialsFile)
+	}
+	if creds == nil && err == nil {
+		creds, err = credentialsFromDockerConfig(dockerConfig, baseURL)
+	}
+	if err != nil || creds == nil {
+		return nil, err
+	}
+	if err := creds.normalize(); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// credentialsFromEnv 读取 HARBOR_TOKEN、HARBOR_USERNAME/HARBOR_PASSWORD(HARBOR_AUTH_TYPE) 或旧的 HARBOR_AUTH
+func credentialsFromEnv() (*credentials, error) {
+	authType := os.Getenv("HARBOR_AUTH_TYPE")
+	if token := os.Getenv("HARBOR_TOKEN"); token != "" {
+		return &credentials{Credentials: harbor.Credentials{Type: harbor.AuthTypeBearer, Token: token}, source: "HARBOR_TOKEN"}, nil
+	}
+	if username := os.Getenv("HARBOR_USERNAME"); username != "" {
+		return &credentials{Credentials: harbor.Credentials{Type: authType, Username: username, Password: os.Getenv("HARBOR_PASSWORD")}, source: "HARBOR_USERNAME"}, nil
+	}
+	if auth := os.Getenv("HARBOR_AUTH"); auth != "" {
+		return credentialsFromAuth(auth, "HARBOR_AUTH")
+	}
+	return nil, nil
+}
+
+// loadCredentialsFile 读取 JSON 凭据文件，如 {"type": "robot", "username": "backup", "password": "<secret>"}
+func loadCredentialsFile(path string) (*credentials, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		fmt.Printf("Warning: credentials file %s is readable by other users, consider chmod 600\n", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	creds := &credentials{source: path}
+	if err := json.Unmarshal(data, &creds.Credentials); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %v", path, err)
+	}
+	return creds, nil
+}
+
+// dockerConfigFile 对应 docker login 写入的 config.json 中与认证有关的部分
+type dockerConfigFile struct {
+	Auths       map[string]dockerAuthEntry `json:"auths"`
+	CredsStore  string                     `json:"credsStore"`
+	CredHelpers map[string]string          `json:"credHelpers"`
+}
+
+type dockerAuthEntry struct {
+	Auth          string `json:"auth"` // base64 编码的 user:password
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// defaultDockerConfigPath 返回 $DOCKER_CONFIG/config.json 或 ~/.docker/config.json
+func defaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// credentialsFromDockerConfig 从 docker config.json 中查找 Harbor 地址的凭据，
+// 支持 auths 中保存的凭据以及 credsStore / credHelpers 凭据助手；文件不存在时返回 nil
+func credentialsFromDockerConfig(path, baseURL string) (*credentials, error) {
+	if path == "" {
+		path = defaultDockerConfigPath()
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker config: %v", err)
+	}
+	var config dockerConfigFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid docker config %s: %v", path, err)
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid baseURL: %v", err)
+	}
+	host := u.Host
+	source := fmt.Sprintf("%s (%s)", path, host)
+
+	if helper := config.CredHelpers[host]; helper != "" {
+		return credentialsFromHelper(helper, host, source)
+	}
+	for key, entry := range config.Auths {
+		if dockerConfigHost(key) != host {
+			continue
+		}
+		switch {
+		case entry.RegistryToken != "":
+			return &credentials{Credentials: harbor.Credentials{Type: harbor.AuthTypeBearer, Token: entry.RegistryToken}, source: source}, nil
+		case entry.Username != "" && entry.Password != "":
+			return &credentials{Credentials: harbor.Credentials{Username: entry.Username, Password: entry.Password}, source: source}, nil
+		case entry.Auth != "":
+			return decodeBasicAuth(entry.Auth, source)
+		}
+	}
+	if config.CredsStore != "" {
+		return credentialsFromHelper(config.CredsStore, host, source)
+	}
+	return nil, nil
+}
+
+// dockerConfigHost 去掉 config.json 中地址的协议和路径，如 https://harbor.example.com/v1/
+func dockerConfigHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if i := strings.Index(key, "/"); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
+
+// credentialsFromHelper 调用 docker-credential-<helper> get 获取凭据，助手中没有该地址时返回 nil
+func credentialsFromHelper(helper, host, source string) (*credentials, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("docker-credential-%s get failed: %v: %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+	var result struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("invalid output from docker-credential-%s: %v", helper, err)
+	}
+	// <token> 表示身份令牌(OAuth refresh token)，Harbor 不支持用它认证
+	if result.Username == "<token>" {
+		return nil, fmt.Errorf("docker-credential-%s returned an identity token for %s, which Harbor does not accept", helper, host)
+	}
+	return &credentials{Credentials: harbor.Credentials{Username: result.Username, Password: result.Secret}, source: source + " via docker-credential-" + helper}, nil
+}
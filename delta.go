@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 差量/增量备份目录中记录新增、删除和重新打 tag 的制品的文件
+const deltaChangesFile = "delta_changes.json"
+
+// DeltaChanges 差量/增量备份相对基准备份的变化，制品按 project/repo 和 digest 比较，与 Harbor 地址无关
+type DeltaChanges struct {
+	BaseBackup string          `json:"base_backup"`
+	Added      []DeltaArtifact `json:"added"`    // 新增的制品，本次差量备份会保存它们
+	Removed    []DeltaArtifact `json:"removed"`  // 基准备份中有、Harbor 中已删除的制品
+	Retagged   []DeltaArtifact `json:"retagged"` // digest 不变但 tag 发生变化的制品
+}
+
+// DeltaArtifact 是 DeltaChanges 中的一个制品
+type DeltaArtifact struct {
+	URI          string   `json:"uri"`
+	Repository   string   `json:"repository"`
+	Digest       string   `json:"digest"`
+	Tags         []string `json:"tags"`
+	PreviousTags []string `json:"previous_tags,omitempty"` // 仅 retagged 有
+}
+
+// Empty 没有任何变化时返回 true
+func (c *DeltaChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Retagged) == 0
+}
+
+// artifactKey 用 project/repo 和 digest 标识一个制品
+func artifactKey(repository, digest string) string {
+	return repository + "@" + digest
+}
+
+// uriKey 去掉 URI 中的 Harbor 地址，无法解析时原样返回
+func uriKey(uri string) string {
+	ref, err := parseArtifactURI(uri)
+	if err != nil {
+		return uri
+	}
+	return artifactKey(ref.Repository, ref.Digest)
+}
+
+// computeDelta 比较 Harbor 当前的制品和基准备份中已保存的制品，
+// 返回需要保存的新增制品和完整的变化记录。tagsKnown 为 false 时(旧备份没有清单)不检测 tag 变化
+func computeDelta(current, previous []BackupArtifact, tagsKnown bool) ([]BackupArtifact, DeltaChanges) {
+	saved := make(map[string]BackupArtifact, len(previous))
+	for _, artifact := range previous {
+		// 上次保存失败的制品视为新增，会在本次重新保存
+		if artifact.Status == artifactStatusOK {
+			saved[artifactKey(artifact.Repository, artifact.Digest)] = artifact
+		}
+	}
+
+	var added []BackupArtifact
+	changes := DeltaChanges{Added: []DeltaArtifact{}, Removed: []DeltaArtifact{}, Retagged: []DeltaArtifact{}}
+	seen := make(map[string]bool, len(current))
+	for _, artifact := range current {
+		key := artifactKey(artifact.Repository, artifact.Digest)
+		seen[key] = true
+
+		old, ok := saved[key]
+		if !ok {
+			added = append(added, artifact)
+			changes.Added = append(changes.Added, toDeltaArtifact(artifact))
+			continue
+		}
+		if tagsKnown && !sameTags(artifact.Tags, old.Tags) {
+			entry := toDeltaArtifact(artifact)
+			entry.PreviousTags = old.Tags
+			changes.Retagged = append(changes.Retagged, entry)
+		}
+	}
+
+	for key, artifact := range saved {
+		if !seen[key] {
+			changes.Removed = append(changes.Removed, toDeltaArtifact(artifact))
+		}
+	}
+
+	for _, list := range [][]DeltaArtifact{changes.Added, changes.Removed, changes.Retagged} {
+		sort.Slice(list, func(i, j int) bool { return list[i].URI < list[j].URI })
+	}
+	return added, changes
+}
+
+func toDeltaArtifact(artifact BackupArtifact) DeltaArtifact {
+	return DeltaArtifact{URI: artifact.URI, Repository: artifact.Repository, Digest: artifact.Digest, Tags: artifact.Tags}
+}
+
+// sameTags 忽略顺序比较两组 tag
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	return strings.Join(sortedA, "\n") == strings.Join(sortedB, "\n")
+}
+
+// writeDeltaChanges 把变化记录写入差量备份目录
+func writeDeltaChanges(dir string, changes DeltaChanges) error {
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, deltaChangesFile), data)
+}
+
+// readDeltaChanges 读取差量/增量备份目录中的变化记录
+func readDeltaChanges(dir string) (*DeltaChanges, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, deltaChangesFile))
+	if err != nil {
+		return nil, err
+	}
+	var changes DeltaChanges
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %v", deltaChangesFile, dir, err)
+	}
+	return &changes, nil
+}
+
+// printDeltaChanges 打印变化汇总
+func printDeltaChanges(changes DeltaChanges) {
+	fmt.Printf("Changes since %s: %d added, %d removed, %d retagged\n",
+		changes.BaseBackup, len(changes.Added), len(changes.Removed), len(changes.Retagged))
+	for _, artifact := range changes.Removed {
+		fmt.Printf("- removed: %s\n", artifact.URI)
+	}
+	for _, artifact := range changes.Retagged {
+		fmt.Printf("- retagged: %s [%s] -> [%s]\n", artifact.URI,
+			strings.Join(artifact.PreviousTags, ", "), strings.Join(artifact.Tags, ", "))
+	}
+}
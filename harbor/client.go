@@ -0,0 +1,113 @@
+// Package harbor 是 Harbor v2.0 API 的客户端：分页、并发地查询项目、仓库和制品，
+// 以及统计信息、健康检查和 ping。所有请求共用一个 Transport，幂等请求遇到临时性错误时自动重试，
+// 失败的响应以 *APIError 返回，可以用 errors.As / errors.Is 判断。
+package harbor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 默认的单个 API 请求超时时间
+const DefaultTimeout = 60 * time.Second
+
+// 默认同时查询的项目或仓库数
+const DefaultConcurrency = 8
+
+// 分页查询时每页的数量，Harbor 允许的最大值
+const PageSize = 100
+
+// Options 创建 Client 的选项，零值表示使用默认值
+type Options struct {
+	// Transport 发送请求，为 nil 时使用 NewTransport(TransportOptions{}) 创建；
+	// 与 registry 下载共用一个 Transport 可以共用连接池
+	Transport http.RoundTripper
+	Timeout   time.Duration // 单个请求(包括读取响应体)的超时时间，默认 DefaultTimeout
+
+	// 请求限流，不大于 0 表示不限制
+	RequestsPerSecond float64
+	MaxInFlight       int
+
+	Concurrency int         // 同时查询的项目或仓库数，默认 DefaultConcurrency
+	Retry       RetryPolicy // 幂等请求的重试策略，MaxAttempts 为 0 时使用 DefaultRetryPolicy
+
+	// BeforeRequest 不为 nil 时在每个请求之前调用，返回错误时不再发起请求，
+	// 如收到停止信号后不再开始新的查询
+	BeforeRequest func(ctx context.Context) error
+}
+
+// Client 访问一个 Harbor 实例的 API，可以在多个 goroutine 中同时使用
+type Client struct {
+	baseURL       string
+	host          string
+	authorization string
+	http          *http.Client
+	retry         RetryPolicy
+	concurrency   int
+	beforeRequest func(ctx context.Context) error
+}
+
+// NewClient 创建访问 baseURL(如 https://harbor.example.com/api/v2.0)的客户端，creds 为 nil 时匿名访问
+func NewClient(baseURL string, creds *Credentials, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid baseURL: %s", baseURL)
+	}
+
+	c := &Client{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		host:          u.Host,
+		retry:         opts.Retry,
+		concurrency:   opts.Concurrency,
+		beforeRequest: opts.BeforeRequest,
+	}
+	if creds != nil {
+		normalized := *creds
+		if err := normalized.Normalize(); err != nil {
+			return nil, err
+		}
+		c.authorization = normalized.Authorization()
+	}
+	if c.retry.MaxAttempts == 0 {
+		c.retry = DefaultRetryPolicy
+	}
+	if c.concurrency <= 0 {
+		c.concurrency = DefaultConcurrency
+	}
+
+	transport := opts.Transport
+	if transport == nil {
+		if transport, err = NewTransport(TransportOptions{}); err != nil {
+			return nil, err
+		}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.http = &http.Client{Transport: transport, Timeout: timeout}
+	if limiter := newRateLimiter(opts.RequestsPerSecond, opts.MaxInFlight); limiter != nil {
+		// 限流时由 limitedTransport 计算超时，排队等待不会导致请求超时
+		c.http = &http.Client{Transport: &limitedTransport{base: transport, limiter: limiter, timeout: timeout}}
+	}
+	return c, nil
+}
+
+// BaseURL 返回 API 地址
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Host 返回 Harbor 的地址(不含协议)，即制品 URI 中的 registry 部分
+func (c *Client) Host() string {
+	return c.host
+}
+
+// Authorization 返回请求使用的 Authorization 头，匿名访问时为空；registry 的 token 服务也接受这个头
+func (c *Client) Authorization() string {
+	return c.authorization
+}
@@ -0,0 +1,239 @@
+package harbor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"harbor_api_mario/harbor"
+	"harbor_api_mario/internal/fakeharbor"
+)
+
+func newClient(t *testing.T, fake *fakeharbor.Server, creds *harbor.Credentials) *harbor.Client {
+	t.Helper()
+	client, err := harbor.NewClient(fake.BaseURL(), creds, harbor.Options{Retry: harbor.RetryPolicy{MaxAttempts: 1}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestPingAndHealthWithoutCredentials(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	client := newClient(t, fake, nil)
+
+	pong, err := client.Ping(context.Background())
+	if err != nil || pong != "Pong" {
+		t.Fatalf("Ping = %q, %v; want Pong", pong, err)
+	}
+	health, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if health.Status != "healthy" || len(health.Components) == 0 {
+		t.Errorf("Health = %+v, want healthy with components", health)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	fake.PushImage("library/nginx", "1.25")
+	fake.PushImage("team/app", "v1")
+
+	stats, err := newClient(t, fake, fake.Credentials()).Statistics(context.Background())
+	if err != nil {
+		t.Fatalf("Statistics: %v", err)
+	}
+	if stats.TotalProjectCount != 2 || stats.TotalRepoCount != 2 {
+		t.Errorf("Statistics = %+v, want 2 projects and 2 repositories", stats)
+	}
+
+	// 没有凭据时返回可以用 errors.Is / errors.As 判断的 APIError
+	_, err = newClient(t, fake, nil).Statistics(context.Background())
+	if !errors.Is(err, harbor.ErrUnauthorized) {
+		t.Fatalf("Statistics without credentials = %v, want ErrUnauthorized", err)
+	}
+	var apiErr *harbor.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 || len(apiErr.Messages) == 0 {
+		t.Errorf("APIError = %+v, want status 401 with the Harbor message", apiErr)
+	}
+	if !harbor.IsPermanent(err) {
+		t.Error("401 should be a permanent error")
+	}
+}
+
+func TestListProjectsPaginates(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	const total = harbor.PageSize + 50
+	for i := 0; i < total; i++ {
+		fake.AddProject(fmt.Sprintf("project-%03d", i))
+	}
+
+	projects, err := newClient(t, fake, fake.Credentials()).ListProjects(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListProjects: %v", err)
+	}
+	if len(projects) != total {
+		t.Fatalf("got %d projects, want %d", len(projects), total)
+	}
+	for i, project := range projects {
+		if want := fmt.Sprintf("project-%03d", i); project.Name != want {
+			t.Fatalf("projects[%d] = %s, want %s", i, project.Name, want)
+		}
+	}
+	if got := fake.Requests("GET", "/api/v2.0/projects"); got != 2 {
+		t.Errorf("listed projects with %d requests, want 2 pages", got)
+	}
+}
+
+func TestQueryReachesEveryPage(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	// 三页，第二页和第三页都按 Harbor 返回的 Link 请求
+	const total = 2*harbor.PageSize + 1
+	for i := 0; i < total; i++ {
+		fake.AddProject(fmt.Sprintf("project-%03d", i))
+	}
+
+	query := url.Values{"q": {"name=~project"}, "sort": {"name"}}
+	seen := 0
+	err := newClient(t, fake, fake.Credentials()).EachProject(context.Background(), query, func(harbor.Project) error {
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachProject: %v", err)
+	}
+	if seen != total {
+		t.Fatalf("visited %d projects, want %d", seen, total)
+	}
+	queries := fake.Queries("GET", "/api/v2.0/projects")
+	if len(queries) != 3 {
+		t.Fatalf("listed projects with %d requests, want 3 pages", len(queries))
+	}
+	for i, got := range queries {
+		if got.Get("q") != "name=~project" || got.Get("sort") != "name" {
+			t.Errorf("page %d query = %v, want q and sort from the caller", i+1, got)
+		}
+		if page := got.Get("page"); page != strconv.Itoa(i+1) {
+			t.Errorf("request %d asked for page %s", i+1, page)
+		}
+	}
+}
+
+func TestCallbackErrorStopsPagination(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	for i := 0; i < harbor.PageSize+1; i++ {
+		fake.PushImage("library/app", fmt.Sprintf("v%d", i))
+	}
+
+	stop := errors.New("stop")
+	seen := 0
+	err := newClient(t, fake, fake.Credentials()).EachArtifact(context.Background(), "library", "app", nil, func(harbor.Artifact) error {
+		seen++
+		if seen == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("EachArtifact = %v, want the callback error", err)
+	}
+	if seen != 3 {
+		t.Errorf("callback ran %d times after returning an error, want 3", seen)
+	}
+	if got := fake.Requests("GET", "/api/v2.0/projects/library/repositories/app/artifacts"); got != 1 {
+		t.Errorf("listed artifacts with %d requests, want only the first page", got)
+	}
+}
+
+func TestListArtifactsOfNestedRepository(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	index, children := fake.PushIndex("library/team/app", "v1", "linux/amd64", "linux/arm64", "unknown/unknown")
+
+	artifacts, err := newClient(t, fake, fake.Credentials()).ListArtifacts(context.Background(), "library/team/app", nil)
+	if err != nil {
+		t.Fatalf("ListArtifacts: %v", err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Digest != index {
+		t.Fatalf("artifacts = %+v, want the index %s", artifacts, index)
+	}
+	references := artifacts[0].References
+	if len(references) != len(children) {
+		t.Fatalf("got %d references, want %d", len(references), len(children))
+	}
+	for i, reference := range references {
+		if reference.ChildDigest != children[i] {
+			t.Errorf("references[%d] = %s, want %s", i, reference.ChildDigest, children[i])
+		}
+	}
+
+	_, err = newClient(t, fake, fake.Credentials()).ListArtifacts(context.Background(), "library/missing", nil)
+	if !errors.Is(err, harbor.ErrNotFound) {
+		t.Errorf("ListArtifacts of a missing repository = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInventoryReusesUnchangedRepositories(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	fake.PushImage("library/nginx", "1.25")
+	fake.PushImage("library/redis", "7")
+	client := newClient(t, fake, fake.Credentials())
+
+	previous, err := client.Inventory(context.Background(), harbor.InventoryOptions{})
+	if err != nil {
+		t.Fatalf("Inventory: %v", err)
+	}
+	if previous.ArtifactsListed != 2 || len(previous.AllArtifacts()) != 2 {
+		t.Fatalf("first inventory listed %d repositories with %d artifacts, want 2 and 2", previous.ArtifactsListed, len(previous.AllArtifacts()))
+	}
+
+	// 只有 redis 有新的推送，nginx 的制品沿用上一次的快照
+	fake.PushImage("library/redis", "7.2")
+	inv, err := client.Inventory(context.Background(), harbor.InventoryOptions{Previous: previous})
+	if err != nil {
+		t.Fatalf("Inventory: %v", err)
+	}
+	if inv.ArtifactsListed != 1 {
+		t.Errorf("refresh listed artifacts of %d repositories, want 1", inv.ArtifactsListed)
+	}
+	if got := len(inv.AllArtifacts()); got != 3 {
+		t.Errorf("refreshed inventory has %d artifacts, want 3", got)
+	}
+	repository, ok := inv.Repository(inv.Repositories[1].ID)
+	if !ok || repository.Name != "library/redis" {
+		t.Errorf("Repository lookup = %v, %v; want library/redis", repository, ok)
+	}
+}
+
+func TestCreateProject(t *testing.T) {
+	fake := fakeharbor.New()
+	defer fake.Close()
+	client := newClient(t, fake, fake.Credentials())
+	ctx := context.Background()
+
+	exists, err := client.ProjectExists(ctx, "backup")
+	if err != nil || exists {
+		t.Fatalf("ProjectExists before create = %v, %v; want false", exists, err)
+	}
+	if err := client.CreateProject(ctx, "backup", false); err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	// 已经存在的项目不算错误
+	if err := client.CreateProject(ctx, "backup", false); err != nil {
+		t.Fatalf("CreateProject of an existing project: %v", err)
+	}
+	exists, err = client.ProjectExists(ctx, "backup")
+	if err != nil || !exists {
+		t.Fatalf("ProjectExists after create = %v, %v; want true", exists, err)
+	}
+}
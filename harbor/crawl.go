@@ -0,0 +1,52 @@
+package harbor
+
+import (
+	"context"
+	"sync"
+)
+
+// crawl 并发地对 items 中的每一项调用 visit(最多 concurrency 个同时进行，
+// 实际同时发出的请求数还受 Options.MaxInFlight 限制)。visit 收到项目在 items 中的下标，
+// 逐页处理查询结果并按下标保存，调用方可以按 items 的顺序拼接，与逐个查询的输出相同。
+// 任何一项失败时取消其余查询并返回最先发生的错误
+func crawl[A any](ctx context.Context, concurrency int, items []A, visit func(context.Context, int, A) error) error {
+	crawlCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var firstErr error
+	var errOnce sync.Once
+
+	concurrencyLimit := concurrency // 并发数量限制
+	if concurrencyLimit < 1 {
+		concurrencyLimit = 1
+	}
+	semaphore := make(chan struct{}, concurrencyLimit)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item A) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}        // 获取信号量
+			defer func() { <-semaphore }() // 释放信号量
+
+			if crawlCtx.Err() != nil {
+				return
+			}
+			if err := visit(crawlCtx, i, item); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, item)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	// ctx 被取消时剩下的项目没有查询，不能返回不完整的结果
+	return ctx.Err()
+}
@@ -0,0 +1,61 @@
+package harbor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// 认证方式
+const (
+	AuthTypeBasic  = "basic"  // 用户名和密码
+	AuthTypeRobot  = "robot"  // Harbor robot 账号，用户名为 robot$name，密码为 robot secret
+	AuthTypeOIDC   = "oidc"   // OIDC 用户名和 CLI secret(在 Harbor 的用户设置中生成)
+	AuthTypeBearer = "bearer" // bearer token
+)
+
+// robot 账号用户名的默认前缀
+const RobotPrefix = "robot$"
+
+// Credentials 访问 Harbor API 和 registry 的凭据
+type Credentials struct {
+	Type     string `json:"type"`     // basic、robot、oidc 或 bearer，为空时按是否有 token 判断
+	Username string `json:"username"` // robot 账号可以省略 robot$ 前缀
+	Password string `json:"password"` // 密码、robot secret 或 OIDC CLI secret
+	Token    string `json:"token"`    // bearer token
+}
+
+// Normalize 补全认证方式和 robot 前缀，并检查必填字段
+func (c *Credentials) Normalize() error {
+	if c.Type == "" {
+		c.Type = AuthTypeBasic
+		if c.Token != "" {
+			c.Type = AuthTypeBearer
+		}
+	}
+	switch c.Type {
+	case AuthTypeBearer:
+		if c.Token == "" {
+			return fmt.Errorf("bearer credentials need a token")
+		}
+	case AuthTypeBasic, AuthTypeRobot, AuthTypeOIDC:
+		if c.Username == "" || c.Password == "" {
+			return fmt.Errorf("%s credentials need a username and a password or secret", c.Type)
+		}
+		if c.Type == AuthTypeRobot && !strings.Contains(c.Username, "$") {
+			c.Username = RobotPrefix + c.Username
+		}
+	default:
+		return fmt.Errorf("unknown auth type %q (supported: basic, robot, oidc, bearer)", c.Type)
+	}
+	return nil
+}
+
+// Authorization 返回 Authorization 头。robot 账号和 OIDC CLI secret 与密码一样使用 Basic 认证，
+// registry 的 token 服务也使用同一个头换取 token
+func (c *Credentials) Authorization() string {
+	if c.Type == AuthTypeBearer {
+		return "Bearer " + c.Token
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+}
@@ -0,0 +1,144 @@
+package harbor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Harbor API 和 registry 请求失败的类型
+const (
+	KindUnauthorized = "unauthorized" // 401：凭据错误或过期
+	KindForbidden    = "forbidden"    // 403：没有权限
+	KindNotFound     = "not found"    // 404
+	KindConflict     = "conflict"     // 409：如项目已经存在
+	KindRateLimited  = "rate limited" // 429
+	KindServerError  = "server error" // 5xx
+	KindUnexpected   = "unexpected"   // 其他状态码
+)
+
+// 与 errors.Is 一起使用，判断 APIError 的类型，如 errors.Is(err, ErrNotFound)
+var (
+	ErrUnauthorized = errors.New(KindUnauthorized)
+	ErrForbidden    = errors.New(KindForbidden)
+	ErrNotFound     = errors.New(KindNotFound)
+	ErrConflict     = errors.New(KindConflict)
+	ErrRateLimited  = errors.New(KindRateLimited)
+	ErrServerError  = errors.New(KindServerError)
+)
+
+// APIError 是 Harbor API 或 registry 返回的错误响应，调用方可以用 errors.As 取出状态码和 Harbor 的错误信息
+type APIError struct {
+	Kind       string   // KindUnauthorized 等
+	StatusCode int      // HTTP 状态码
+	Method     string   // 请求方法
+	URL        string   // 请求地址(去掉了密码)
+	Messages   []string // Harbor 返回的 errors[].message，不是 JSON 时为响应体的开头
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s failed, status code: %d (%s)", e.Method, e.URL, e.StatusCode, e.Kind)
+	if len(e.Messages) > 0 {
+		msg += ": " + strings.Join(e.Messages, "; ")
+	}
+	return msg
+}
+
+// 每种错误类型对应的 errors.Is 目标
+var kindSentinels = map[string]error{
+	KindUnauthorized: ErrUnauthorized,
+	KindForbidden:    ErrForbidden,
+	KindNotFound:     ErrNotFound,
+	KindConflict:     ErrConflict,
+	KindRateLimited:  ErrRateLimited,
+	KindServerError:  ErrServerError,
+}
+
+// Is 使 errors.Is(err, ErrNotFound) 等按类型匹配
+func (e *APIError) Is(target error) bool {
+	sentinel, ok := kindSentinels[e.Kind]
+	return ok && sentinel == target
+}
+
+// IsPermanent 返回 true 表示错误不是临时性的(401、403、404、409)，重试也不会成功
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) ||
+		errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict)
+}
+
+// NewAPIError 根据失败的响应创建 APIError，读取(最多 64KB)但不关闭响应体
+func NewAPIError(resp *http.Response) *APIError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	method, url := "", ""
+	if resp.Request != nil {
+		method, url = resp.Request.Method, resp.Request.URL.Redacted()
+	}
+	return apiErrorFromBody(method, url, resp.StatusCode, body)
+}
+
+// apiErrorFromBody 根据状态码和已经读取的响应体创建 APIError
+func apiErrorFromBody(method, url string, statusCode int, body []byte) *APIError {
+	return &APIError{
+		Kind:       errorKind(statusCode),
+		StatusCode: statusCode,
+		Method:     method,
+		URL:        url,
+		Messages:   errorMessages(body),
+	}
+}
+
+// errorKind 按状态码确定错误类型
+func errorKind(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return KindUnauthorized
+	case statusCode == http.StatusForbidden:
+		return KindForbidden
+	case statusCode == http.StatusNotFound:
+		return KindNotFound
+	case statusCode == http.StatusConflict:
+		return KindConflict
+	case statusCode == http.StatusTooManyRequests:
+		return KindRateLimited
+	case statusCode >= 500:
+		return KindServerError
+	}
+	return KindUnexpected
+}
+
+// errorMessages 解析 Harbor 和 registry 的错误响应 {"errors": [{"code": "NOT_FOUND", "message": "..."}]}，
+// 不是这种格式时返回响应体的开头
+func errorMessages(body []byte) []string {
+	var payload struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &payload) == nil && len(payload.Errors) > 0 {
+		var messages []string
+		for _, e := range payload.Errors {
+			switch {
+			case e.Code != "" && e.Message != "":
+				messages = append(messages, e.Code+": "+e.Message)
+			case e.Message != "":
+				messages = append(messages, e.Message)
+			case e.Code != "":
+				messages = append(messages, e.Code)
+			}
+		}
+		return messages
+	}
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return nil
+	}
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return []string{text}
+}
@@ -0,0 +1,49 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Health 获取 Harbor 及其各组件的健康状态，只有 Status 为 "healthy" 时才表示 Harbor API 健康。
+// 健康检查不需要认证，也不重试
+func (c *Client) Health(ctx context.Context) (*HealthStatus, error) {
+	body, err := c.getUnauthenticated(ctx, "/health")
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析 JSON 响应
+	var healthStatus HealthStatus
+	if err := json.Unmarshal(body, &healthStatus); err != nil {
+		return nil, fmt.Errorf("error parsing JSON response: %v", err)
+	}
+	return &healthStatus, nil
+}
+
+// getUnauthenticated 发送一次不带认证的 GET 请求，状态码不是 200 时返回 *APIError
+func (c *Client) getUnauthenticated(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer DrainBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewAPIError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,138 @@
+package harbor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Inventory 是一次遍历 项目 → 仓库 → 制品 得到的 Harbor 快照，可以编码为 JSON 缓存，
+// 下一次遍历时作为 InventoryOptions.Previous 只查询有变化的仓库的制品
+type Inventory struct {
+	Host         string             `json:"host"` // Harbor 地址(不含协议)，用于生成 URI
+	Projects     []Project          `json:"projects"`
+	Repositories []Repository       `json:"repositories"` // 按项目顺序
+	Artifacts    map[int][]Artifact `json:"artifacts"`    // 按仓库 ID 索引，没有查询制品的仓库不在其中
+
+	// 本次遍历实际查询了制品的仓库数，沿用 Previous 或被跳过的仓库不计算在内
+	ArtifactsListed int `json:"-"`
+
+	indexOnce    sync.Once
+	projectsByID map[int]*Project    // 按项目 ID 索引
+	reposByID    map[int]*Repository // 按仓库 ID 索引
+}
+
+// InventoryOptions 遍历 Harbor 的选项
+type InventoryOptions struct {
+	// SkipArtifacts 对某个仓库返回 true 时不查询它的制品(如增量备份中没有变化的仓库)，为 nil 时查询全部仓库
+	SkipArtifacts func(Repository) bool
+	// Previous 是上一次的快照，仓库的 update_time 和 artifact_count 都没有变化时直接沿用其中的制品
+	Previous *Inventory
+}
+
+// Inventory 遍历 Harbor 得到快照，仓库和制品按项目、仓库并发查询
+func (c *Client) Inventory(ctx context.Context, opts InventoryOptions) (*Inventory, error) {
+	projects, err := c.ListProjects(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	repositories, err := c.listProjectsRepositories(ctx, projects)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个仓库的制品逐页追加到它在 repositories 中的位置，listed[i] 表示第 i 个仓库有结果
+	artifacts := make([][]Artifact, len(repositories))
+	listed := make([]bool, len(repositories))
+	var listedCount int64
+	err = crawl(ctx, c.concurrency, repositories, func(ctx context.Context, i int, repository Repository) error {
+		if previous, ok := opts.Previous.unchangedArtifacts(repository); ok {
+			artifacts[i], listed[i] = previous, true
+			return nil
+		}
+		if opts.SkipArtifacts != nil && opts.SkipArtifacts(repository) {
+			return nil
+		}
+		project, name, err := splitRepositoryName(repository.Name)
+		if err != nil {
+			return err
+		}
+		err = c.EachArtifact(ctx, project, name, nil, func(artifact Artifact) error {
+			artifacts[i] = append(artifacts[i], artifact)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		listed[i] = true
+		atomic.AddInt64(&listedCount, 1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{
+		Host:            c.host,
+		Projects:        projects,
+		Repositories:    repositories,
+		Artifacts:       make(map[int][]Artifact, len(repositories)),
+		ArtifactsListed: int(listedCount),
+	}
+	for i, repository := range repositories {
+		if listed[i] {
+			inv.Artifacts[repository.ID] = artifacts[i]
+		}
+	}
+	return inv, nil
+}
+
+// unchangedArtifacts 返回快照中仓库的制品，仓库不在快照中、快照中没有它的制品或者 update_time、artifact_count 有变化时返回 false
+func (inv *Inventory) unchangedArtifacts(repository Repository) ([]Artifact, bool) {
+	if inv == nil {
+		return nil, false
+	}
+	cached, ok := inv.Repository(repository.ID)
+	if !ok || cached.UpdateTime != repository.UpdateTime || cached.ArtifactCount != repository.ArtifactCount {
+		return nil, false
+	}
+	artifacts, ok := inv.Artifacts[repository.ID]
+	return artifacts, ok
+}
+
+// index 第一次按 ID 查找时建立项目和仓库的索引，从 JSON 解码的快照也可以直接使用
+func (inv *Inventory) index() {
+	inv.indexOnce.Do(func() {
+		inv.projectsByID = make(map[int]*Project, len(inv.Projects))
+		for i := range inv.Projects {
+			inv.projectsByID[inv.Projects[i].ProjectID] = &inv.Projects[i]
+		}
+		inv.reposByID = make(map[int]*Repository, len(inv.Repositories))
+		for i := range inv.Repositories {
+			inv.reposByID[inv.Repositories[i].ID] = &inv.Repositories[i]
+		}
+	})
+}
+
+// Project 按 ID 查找项目
+func (inv *Inventory) Project(id int) (*Project, bool) {
+	inv.index()
+	project, ok := inv.projectsByID[id]
+	return project, ok
+}
+
+// Repository 按 ID 查找仓库
+func (inv *Inventory) Repository(id int) (*Repository, bool) {
+	inv.index()
+	repository, ok := inv.reposByID[id]
+	return repository, ok
+}
+
+// AllArtifacts 按仓库顺序返回全部制品
+func (inv *Inventory) AllArtifacts() []Artifact {
+	var artifacts []Artifact
+	for _, repository := range inv.Repositories {
+		artifacts = append(artifacts, inv.Artifacts[repository.ID]...)
+	}
+	return artifacts
+}
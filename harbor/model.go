@@ -1,4 +1,4 @@
-package main
+package harbor
 
 // Data structures (omitted for brevity, use the ones from the initial example)
 
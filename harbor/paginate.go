@@ -0,0 +1,119 @@
+package harbor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// paginate 逐页查询 Harbor 的列表接口 path(相对于 API 地址)，把每一项交给 fn 处理而不是全部缓存在内存中。
+// query 是额外的查询参数(如 q、sort)，page 和 page_size 由 paginate 设置。
+// 下一页按 Harbor 返回的 Link: rel="next" 确定；没有 Link 时按 X-Total-Count 判断是否还有下一页，
+// 两者都没有时遇到不满一页的结果就结束。fn 返回错误时停止查询并返回该错误
+func paginate[T any](ctx context.Context, c *Client, path string, query url.Values, fn func(T) error) error {
+	params := url.Values{}
+	for key, values := range query {
+		params[key] = values
+	}
+	params.Set("page", "1")
+	params.Set("page_size", strconv.Itoa(PageSize))
+	next := c.baseURL + path + "?" + params.Encode()
+
+	seen := 0
+	var previous []byte
+	for page := 1; next != ""; page++ {
+		body, header, err := c.getPage(ctx, next)
+		if err != nil {
+			return err
+		}
+		// 忽略 page 参数、每次都返回同一页的服务端，避免无限循环
+		if previous != nil && bytes.Equal(body, previous) {
+			break
+		}
+		previous = body
+
+		var items []T
+		if err := json.Unmarshal(body, &items); err != nil {
+			return fmt.Errorf("failed to decode %s: %v", next, err)
+		}
+		for _, item := range items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		seen += len(items)
+
+		current := next
+		next = ""
+		if link := nextLink(header.Get("Link")); link != "" {
+			resolved, err := resolvePageURL(current, link)
+			if err != nil {
+				return err
+			}
+			if resolved != current {
+				next = resolved
+			}
+			continue
+		}
+		if len(items) == 0 {
+			break
+		}
+		if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+			if seen >= total {
+				break
+			}
+		} else if len(items) < PageSize {
+			break
+		}
+		params.Set("page", strconv.Itoa(page+1))
+		next = c.baseURL + path + "?" + params.Encode()
+	}
+	return nil
+}
+
+// fetchPaged 查询列表接口的所有页并返回全部结果
+func fetchPaged[T any](ctx context.Context, c *Client, path string, query url.Values) ([]T, error) {
+	var items []T
+	err := paginate(ctx, c, path, query, func(item T) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// nextLink 从 Link 头中取出 rel="next" 的地址，如 </api/v2.0/projects?page=2&page_size=100>; rel="next"
+func nextLink(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(part, ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "rel") && strings.Trim(value, `"`) == "next" {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// resolvePageURL 把 Link 中的地址(通常只有路径和查询参数)转换为完整地址
+func resolvePageURL(current, link string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid Link header %q: %v", link, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
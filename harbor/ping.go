@@ -0,0 +1,14 @@
+package harbor
+
+import "context"
+
+// Ping Harbor to check if it's alive.
+// This API simply replies a pong to indicate the process to handle API is up, disregarding the health status of dependent components.
+// Ping 返回 /ping 的响应内容，Harbor 存活时为 "Pong"
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	body, err := c.getUnauthenticated(ctx, "/ping")
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
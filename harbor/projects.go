@@ -0,0 +1,137 @@
+package harbor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// EachProject 逐页查询项目，把每个项目交给 fn 处理。query 是额外的查询参数，
+// 如 q=name=~team 或 sort=name，每一页请求都会带上。fn 返回错误时停止查询并返回该错误
+func (c *Client) EachProject(ctx context.Context, query url.Values, fn func(Project) error) error {
+	return paginate(ctx, c, "/projects", query, fn)
+}
+
+// ListProjects 获取符合 query 的全部项目，query 为 nil 时获取全部项目
+func (c *Client) ListProjects(ctx context.Context, query url.Values) ([]Project, error) {
+	return fetchPaged[Project](ctx, c, "/projects", query)
+}
+
+// EachRepository 逐页查询一个项目的仓库，把每个仓库交给 fn 处理，query 和 fn 与 EachProject 相同
+func (c *Client) EachRepository(ctx context.Context, project string, query url.Values, fn func(Repository) error) error {
+	return paginate(ctx, c, projectRepositoriesPath(project), query, fn)
+}
+
+// ListRepositories 获取一个项目中符合 query 的全部仓库
+func (c *Client) ListRepositories(ctx context.Context, project string, query url.Values) ([]Repository, error) {
+	return fetchPaged[Repository](ctx, c, projectRepositoriesPath(project), query)
+}
+
+// ListAllRepositories 获取全部项目的仓库，按项目顺序返回
+func (c *Client) ListAllRepositories(ctx context.Context) ([]Repository, error) {
+	projects, err := c.ListProjects(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.listProjectsRepositories(ctx, projects)
+}
+
+// listProjectsRepositories 并发查询各个项目的仓库，按项目顺序返回
+func (c *Client) listProjectsRepositories(ctx context.Context, projects []Project) ([]Repository, error) {
+	repositories := make([][]Repository, len(projects))
+	err := crawl(ctx, c.concurrency, projects, func(ctx context.Context, i int, project Project) error {
+		return c.EachRepository(ctx, project.Name, nil, func(repository Repository) error {
+			repositories[i] = append(repositories[i], repository)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	var all []Repository
+	for _, list := range repositories {
+		all = append(all, list...)
+	}
+	return all, nil
+}
+
+// EachArtifact 逐页查询仓库的制品，把每个制品交给 fn 处理。repository 是项目中的仓库名(不含项目名，
+// 可以包含 /，如 team/app)，query 和 fn 与 EachProject 相同
+func (c *Client) EachArtifact(ctx context.Context, project, repository string, query url.Values, fn func(Artifact) error) error {
+	return paginate(ctx, c, repositoryArtifactsPath(project, repository), query, fn)
+}
+
+// ListArtifacts 获取一个仓库(完整名称，如 library/nginx)中符合 query 的全部制品
+func (c *Client) ListArtifacts(ctx context.Context, repository string, query url.Values) ([]Artifact, error) {
+	project, name, err := splitRepositoryName(repository)
+	if err != nil {
+		return nil, err
+	}
+	return fetchPaged[Artifact](ctx, c, repositoryArtifactsPath(project, name), query)
+}
+
+// ListAllArtifacts 获取全部仓库的制品，按仓库顺序返回
+func (c *Client) ListAllArtifacts(ctx context.Context) ([]Artifact, error) {
+	inv, err := c.Inventory(ctx, InventoryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return inv.AllArtifacts(), nil
+}
+
+// projectRepositoriesPath 返回项目仓库列表接口的路径
+func projectRepositoriesPath(project string) string {
+	return "/projects/" + url.PathEscape(project) + "/repositories"
+}
+
+// splitRepositoryName 把仓库的完整名称拆分为项目名和项目中的仓库名
+func splitRepositoryName(repository string) (string, string, error) {
+	repoNameParts := strings.SplitN(repository, "/", 2)
+	if len(repoNameParts) != 2 {
+		return "", "", fmt.Errorf("invalid repository name format: %s", repository)
+	}
+	return repoNameParts[0], repoNameParts[1], nil
+}
+
+// repositoryArtifactsPath 返回仓库制品列表接口的路径，仓库名中的 / 需要编码两次
+func repositoryArtifactsPath(project, repository string) string {
+	encodedRepoName := url.PathEscape(repository)
+	doubleEncodedRepoName := url.PathEscape(encodedRepoName)
+
+	return fmt.Sprintf("/projects/%s/repositories/%s/artifacts", url.PathEscape(project), doubleEncodedRepoName)
+}
+
+// ProjectExists 判断项目是否存在
+func (c *Client) ProjectExists(ctx context.Context, name string) (bool, error) {
+	checkURL := fmt.Sprintf("%s/projects?project_name=%s", c.baseURL, url.QueryEscape(name))
+	status, err := c.head(ctx, checkURL)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, apiErrorFromBody("HEAD", checkURL, status, nil)
+}
+
+// CreateProject 创建项目，项目已经存在(如被并发创建)时不返回错误
+func (c *Client) CreateProject(ctx context.Context, name string, public bool) error {
+	payload := map[string]interface{}{
+		"project_name": name,
+		"metadata":     map[string]string{"public": fmt.Sprint(public)},
+	}
+	status, body, err := c.postJSON(ctx, c.baseURL+"/projects", payload)
+	if err != nil {
+		return err
+	}
+	// 409 表示项目已存在
+	if status != http.StatusCreated && status != http.StatusConflict {
+		return apiErrorFromBody("POST", c.baseURL+"/projects", status, body)
+	}
+	return nil
+}
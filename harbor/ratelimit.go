@@ -0,0 +1,107 @@
+package harbor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter 限制 Harbor API 请求的速率和同时进行的请求数，避免遍历大量项目和仓库时压垮 Harbor core 和数据库
+type rateLimiter struct {
+	interval time.Duration // 两次请求之间的最小间隔，0 表示不限制速率
+	inFlight chan struct{} // 同时进行的请求数，nil 表示不限制
+
+	mu   sync.Mutex
+	next time.Time // 下一个请求最早可以发出的时间
+}
+
+// newRateLimiter 创建限流器，rps 和 maxInFlight 都不大于 0 时返回 nil(不限流)
+func newRateLimiter(rps float64, maxInFlight int) *rateLimiter {
+	if rps <= 0 && maxInFlight <= 0 {
+		return nil
+	}
+	l := &rateLimiter{}
+	if rps > 0 {
+		l.interval = time.Duration(float64(time.Second) / rps)
+	}
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// acquire 等待可以发出下一个请求，返回的函数在请求结束(响应体关闭)时调用
+func (l *rateLimiter) acquire(ctx context.Context) (func(), error) {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}
+
+	if l.interval > 0 {
+		// 预约一个发送时间，排在前面请求之后
+		l.mu.Lock()
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		wait := l.next.Sub(now)
+		l.next = l.next.Add(l.interval)
+		l.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// limitedTransport 在发送请求前经过限流器；超时从拿到名额之后开始计算，排队等待的时间不算在内
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+	timeout time.Duration // 单个请求(包括读取响应体)的超时时间
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		release()
+		return nil, err
+	}
+	// 读完响应体之前请求仍然占用一个并发名额
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() {
+		cancel()
+		release()
+	}}
+	return resp, nil
+}
+
+// releasingBody 在关闭时释放限流器的并发名额
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,106 @@
+package harbor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// getPage 发送 GET 请求，返回响应体和响应头(分页查询从中读取 X-Total-Count 和 Link)；
+// 状态码不是 200 时返回 *APIError
+func (c *Client) getPage(ctx context.Context, url string) ([]byte, http.Header, error) {
+	if c.beforeRequest != nil {
+		if err := c.beforeRequest(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// GET 是幂等的，网络错误和 5xx/429 会自动重试
+	resp, err := c.retry.Do(c.http, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.setAuthorization(req)
+		return req, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer DrainBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, NewAPIError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, resp.Header, nil
+}
+
+// getJSON 发送 GET 请求并把响应解析到 v
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	body, _, err := c.getPage(ctx, c.baseURL+path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// head 发送 HEAD 请求并返回状态码
+func (c *Client) head(ctx context.Context, url string) (int, error) {
+	resp, err := c.retry.Do(c.http, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.setAuthorization(req)
+		return req, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// postJSON 发送 JSON POST 请求(不重试)，返回状态码和响应体
+func (c *Client) postJSON(ctx context.Context, url string, payload interface{}) (int, []byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	c.setAuthorization(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// setAuthorization 匿名访问时不设置 Authorization 头
+func (c *Client) setAuthorization(req *http.Request) {
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+}
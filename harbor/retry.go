@@ -0,0 +1,134 @@
+package harbor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 控制失败请求的重试次数和等待时间
+type RetryPolicy struct {
+	MaxAttempts int           // 包括第一次在内的最多尝试次数，1 表示不重试
+	BaseDelay   time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 单次等待的上限，Retry-After 也不会超过它
+
+	// OnRetry 不为 nil 时在每次重试之前调用，attempt 是即将进行的尝试(从 2 开始)
+	OnRetry func(operation string, attempt int, delay time.Duration, reason string)
+	// OnGiveUp 不为 nil 时在重试用尽后仍然失败时调用；请求被取消时不调用
+	OnGiveUp func(operation string, err error)
+}
+
+// 幂等 API 请求默认的重试策略
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+// Backoff 返回第 attempt 次重试(从 1 开始)前的等待时间：指数增长，并在后一半区间内随机抖动，
+// 避免并发的请求同时重试
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 31 {
+		if d := p.BaseDelay << uint(attempt-1); d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryableStatus 返回 true 表示该状态码通常是临时性的，可以重试
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter 解析 Retry-After 头，支持秒数和 HTTP 日期两种格式
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		delay := time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// Do 发送幂等请求(GET/HEAD)，遇到网络错误或临时性状态码(408、429、5xx)时按策略重试，
+// 有 Retry-After 时按它等待；newRequest 每次返回一个新的请求，请求的 context 取消时停止等待。
+// 重试用尽后返回最后一次的响应或错误
+func (p RetryPolicy) Do(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		operation := req.Method + " " + req.URL.Redacted()
+
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= p.MaxAttempts || req.Context().Err() != nil {
+			if p.MaxAttempts > 1 && req.Context().Err() == nil && p.OnGiveUp != nil {
+				if err != nil {
+					p.OnGiveUp(operation, err)
+				} else {
+					p.OnGiveUp(operation, fmt.Errorf("status code: %d", resp.StatusCode))
+				}
+			}
+			return resp, err
+		}
+
+		delay := p.Backoff(attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("status code: %d", resp.StatusCode)
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+				if delay > p.MaxDelay {
+					delay = p.MaxDelay
+				}
+			}
+			DrainBody(resp.Body)
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(operation, attempt+1, delay, reason)
+		}
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回 ctx.Err()
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,22 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Statistics 获取 Harbor 统计信息
+func (c *Client) Statistics(ctx context.Context) (*HarborStatistics, error) {
+	body, _, err := c.getPage(ctx, c.baseURL+"/statistics")
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析 JSON 响应
+	var stats HarborStatistics
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, fmt.Errorf("error parsing JSON response: %v", err)
+	}
+	return &stats, nil
+}
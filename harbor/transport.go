@@ -0,0 +1,92 @@
+package harbor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportOptions 创建共享 Transport 的选项
+type TransportOptions struct {
+	CAFile   string // 额外信任的 CA 证书(PEM)，与系统 CA 一起使用
+	CertFile string // 客户端证书(PEM)，与 KeyFile 一起使用
+	KeyFile  string
+	Insecure bool   // 跳过 TLS 证书校验
+	Proxy    string // 代理地址，为空时使用 HTTPS_PROXY / HTTP_PROXY / NO_PROXY
+
+	// 等待响应头的时间，默认 DefaultTimeout；registry 传输 blob 时只受这个时间限制
+	ResponseHeaderTimeout time.Duration
+}
+
+// NewTransport 创建带 TLS、代理和连接池设置的 Transport。
+// 所有请求共用一个 Transport，分页等大量请求可以复用 keep-alive 连接
+func NewTransport(opts TransportOptions) (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+	if opts.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL: %s", opts.Proxy)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	timeout := opts.ResponseHeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32, // 默认只保留 2 个空闲连接，并发分页时会不断重新建立连接
+		IdleConnTimeout:       90 * time.Second,
+	}, nil
+}
+
+// DrainBody 读完并关闭响应体，连接才能放回连接池复用
+func DrainBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, 1<<20))
+	body.Close()
+}
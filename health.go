@@ -1,53 +1,35 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-)
 
-// Health check API
-// The endpoint returns the health stauts of the system.
-// CheckHarborHealth 检查 Harbor API 健康状态，只有返回状态为 "healthy" 时才表示 Harbor API 健康
-func CheckHarborHealth(baseURL string) (bool, error) {
-	// 路径
-	path := "/health"
+	"harbor_api_mario/harbor"
+)
 
-	// 构造请求
-	req, err := http.NewRequest("GET", baseURL+path, nil)
+// checkHarborPing 检查 Harbor 是否可用，只有返回 "Pong" 时才表示 Harbor 存活
+func checkHarborPing(ctx context.Context, client *harbor.Client) (bool, error) {
+	pong, err := client.Ping(ctx)
 	if err != nil {
-		fmt.Println("Error creating request:", err)
 		return false, err
 	}
 
-	// 发送请求
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error sending request:", err)
-		return false, err
-	}
-	defer resp.Body.Close()
+	// 输出调试信息
+	fmt.Println("Ping response:", pong)
 
-	// 检查状态码
-	if resp.StatusCode != http.StatusOK {
-		fmt.Println("Unexpected status code:", resp.StatusCode)
-		return false, fmt.Errorf("unexpected status code: %v", resp.StatusCode)
+	// 判断是否返回 Pong
+	if pong != "Pong" {
+		fmt.Println("Harbor is not alive.")
+		return false, nil
 	}
 
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Error reading response:", err)
-		return false, err
-	}
+	return true, nil
+}
 
-	// 解析 JSON 响应
-	var healthStatus HealthStatus
-	err = json.Unmarshal(body, &healthStatus)
+// checkHarborHealth 检查 Harbor API 健康状态，只有返回状态为 "healthy" 时才表示 Harbor API 健康
+func checkHarborHealth(ctx context.Context, client *harbor.Client) (bool, error) {
+	healthStatus, err := client.Health(ctx)
 	if err != nil {
-		fmt.Println("Error parsing JSON response:", err)
 		return false, err
 	}
 
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// httpClientOptions 创建共享 HTTP 客户端的选项
+type httpClientOptions struct {
+	Timeout  time.Duration // 单个 API 请求的超时时间，registry 传输 blob 时只限制等待响应头的时间
+	CAFile   string        // 额外信任的 CA 证书(PEM)，与系统 CA 一起使用
+	CertFile string        // 客户端证书(PEM)，与 KeyFile 一起使用
+	KeyFile  string
+	Insecure bool   // 跳过 TLS 证书校验
+	Proxy    string // 代理地址，为空时使用 HTTPS_PROXY / HTTP_PROXY / NO_PROXY
+
+	// Harbor API 请求的限流，不影响 registry blob 的下载；不大于 0 表示不限制
+	APIRequestsPerSecond float64
+	APIMaxInFlight       int
+}
+
+// registry 拉取和推送 blob 用的客户端，与 Harbor API 客户端共用连接池，但不限制整个请求的时间
+var transferClient = &http.Client{}
+
+// configureHTTPClients 根据选项创建共享的 Transport 并设置 transferClient，
+// 返回创建 Harbor API 客户端用的选项；API 请求另外经过 harbor 包的限流器
+func configureHTTPClients(opts httpClientOptions) (harbor.Options, error) {
+	transport, err := harbor.NewTransport(harbor.TransportOptions{
+		CAFile:                opts.CAFile,
+		CertFile:              opts.CertFile,
+		KeyFile:               opts.KeyFile,
+		Insecure:              opts.Insecure,
+		Proxy:                 opts.Proxy,
+		ResponseHeaderTimeout: opts.Timeout,
+	})
+	if err != nil {
+		return harbor.Options{}, err
+	}
+	transferClient = &http.Client{Transport: transport}
+	return harbor.Options{
+		Transport:         transport,
+		Timeout:           opts.Timeout,
+		RequestsPerSecond: opts.APIRequestsPerSecond,
+		MaxInFlight:       opts.APIMaxInFlight,
+	}, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 多架构镜像的索引(清单列表)保存在备份目录的 indexes/ 中，目录结构与 OCI 布局的 blobs/sha256/<hex> 相同。
+// 除了索引本身，还保存没有作为制品备份的子清单(如 unknown/unknown 的构建证明)及其 blob，
+// 因为 Harbor 只接受子清单都已存在的索引
+const indexesDir = "indexes"
+
+// indexGroup 是备份清单中属于同一个多架构镜像的子制品
+type indexGroup struct {
+	Repository string
+	Digest     string          // 索引的 digest
+	Host       string          // 备份时的 Harbor 地址
+	Children   map[string]bool // 作为制品备份的子清单 digest
+	Tags       []string
+}
+
+// groupByIndex 按 仓库@索引 digest 对多架构子制品分组，只统计满足 include 的子制品，结果按 key 排序
+func groupByIndex(artifacts []BackupArtifact, include func(BackupArtifact) bool) []*indexGroup {
+	groups := make(map[string]*indexGroup)
+	var keys []string
+	for _, artifact := range artifacts {
+		if artifact.ParentDigest == "" || !include(artifact) {
+			continue
+		}
+		key := artifactKey(artifact.Repository, artifact.ParentDigest)
+		group, ok := groups[key]
+		if !ok {
+			ref, _ := parseArtifactURI(artifact.URI)
+			group = &indexGroup{Repository: artifact.Repository, Digest: artifact.ParentDigest, Host: ref.Host, Children: make(map[string]bool)}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.Children[artifact.Digest] = true
+		group.Tags = artifact.Tags
+	}
+	sort.Strings(keys)
+	result := make([]*indexGroup, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, groups[key])
+	}
+	return result
+}
+
+// saveIndexes 为备份清单中至少保存了一个子制品的多架构镜像保存索引，已经保存过的(续传)跳过。
+// 某个索引保存失败时，它的子制品标记为失败，续传时重新保存
+func saveIndexes(ctx context.Context, manifest *BackupManifest, savePath string, registry *registryClient) {
+	groups := groupByIndex(manifest.Artifacts, func(artifact BackupArtifact) bool {
+		return artifact.Status == artifactStatusOK
+	})
+	for _, group := range groups {
+		if stopping(ctx) {
+			return
+		}
+		err := saveIndex(ctx, registry, filepath.Join(savePath, indexesDir), group)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("failed to save index %s/%s@%s: %w", group.Host, group.Repository, group.Digest, err)
+		fmt.Printf("%v\n", err)
+		for i := range manifest.Artifacts {
+			artifact := &manifest.Artifacts[i]
+			if artifact.Repository == group.Repository && artifact.ParentDigest == group.Digest {
+				artifact.Status = artifactStatusFailed
+				artifact.Error = err.Error()
+			}
+		}
+	}
+}
+
+// saveIndex 把索引和没有作为制品备份的子清单写入 dir，索引最后写入，存在即表示完整
+func saveIndex(ctx context.Context, registry *registryClient, dir string, group *indexGroup) error {
+	indexPath := filepath.Join(dir, filepath.FromSlash(blobPath(group.Digest)))
+	if _, err := os.Stat(indexPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return err
+	}
+
+	indexBytes, _, err := registry.fetchManifest(ctx, group.Host, group.Repository, group.Digest)
+	if err != nil {
+		return err
+	}
+	var index imageManifest
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return fmt.Errorf("error parsing index: %v", err)
+	}
+
+	ref := artifactRef{Host: group.Host, Repository: group.Repository}
+	for _, child := range index.Manifests {
+		if group.Children[child.Digest] {
+			continue
+		}
+		childBytes, _, err := registry.fetchManifest(ctx, group.Host, group.Repository, child.Digest)
+		if err != nil {
+			return err
+		}
+		var m imageManifest
+		if err := json.Unmarshal(childBytes, &m); err != nil {
+			return fmt.Errorf("error parsing manifest %s: %v", child.Digest, err)
+		}
+		for _, blob := range append([]descriptor{m.Config}, m.Layers...) {
+			if err := saveIndexBlob(ctx, registry, dir, ref, blob); err != nil {
+				return err
+			}
+		}
+		if err := writeFileAtomic(filepath.Join(dir, filepath.FromSlash(blobPath(child.Digest))), childBytes); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(indexPath, indexBytes)
+}
+
+// saveIndexBlob 下载子清单引用的 blob，已存在且大小一致时跳过
+func saveIndexBlob(ctx context.Context, registry *registryClient, dir string, ref artifactRef, blob descriptor) error {
+	path := filepath.Join(dir, filepath.FromSlash(blobPath(blob.Digest)))
+	if info, err := os.Stat(path); err == nil && info.Size() == blob.Size {
+		return nil
+	}
+
+	body, err := registry.fetchBlob(ctx, ref.Host, ref.Repository, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmpPath := path + ".partial"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = copyVerified(f, body, blob)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// restoreIndex 是恢复时要在子制品之后推送的索引
+type restoreIndex struct {
+	Repository string
+	Digest     string
+	Source     string          // 保存索引的 indexes 目录；备份中没有索引时为空
+	Children   map[string]bool // 本次恢复的子清单 digest
+	Tags       []string
+}
+
+// locateRestoreIndexes 找出 items 中多架构子制品所属的索引，在备份链中(从新到旧)查找保存的索引
+func locateRestoreIndexes(chain []string, artifacts []BackupArtifact, items []restoreItem) []restoreIndex {
+	restoring := make(map[string]bool, len(items))
+	for _, item := range items {
+		restoring[artifactKey(item.Ref.Repository, item.Ref.Digest)] = true
+	}
+	groups := groupByIndex(artifacts, func(artifact BackupArtifact) bool {
+		return restoring[artifactKey(artifact.Repository, artifact.Digest)]
+	})
+
+	indexes := make([]restoreIndex, 0, len(groups))
+	for _, group := range groups {
+		index := restoreIndex{Repository: group.Repository, Digest: group.Digest, Children: group.Children, Tags: group.Tags}
+		for i := len(chain) - 1; i >= 0; i-- {
+			dir := filepath.Join(chain[i], indexesDir)
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(blobPath(group.Digest)))); err == nil {
+				index.Source = dir
+				break
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// pushRestoreIndex 推送没有作为制品备份的子清单和索引，再把 tag 推送到索引上。
+// restored 是本次恢复成功的制品(project/repo@digest)，索引的其余子清单必须在 index.Source 中
+func pushRestoreIndex(ctx context.Context, registry *registryClient, host string, index restoreIndex, restored map[string]bool) error {
+	indexBytes, err := ioutil.ReadFile(filepath.Join(index.Source, filepath.FromSlash(blobPath(index.Digest))))
+	if err != nil {
+		return err
+	}
+	var m imageManifest
+	if err := json.Unmarshal(indexBytes, &m); err != nil {
+		return fmt.Errorf("invalid index %s: %v", index.Digest, err)
+	}
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = mediaTypeOCIIndex
+	}
+
+	ref := artifactRef{Host: host, Repository: index.Repository, Digest: index.Digest}
+	for _, child := range m.Manifests {
+		if index.Children[child.Digest] {
+			if !restored[artifactKey(index.Repository, child.Digest)] {
+				return fmt.Errorf("child %s was not restored with its original digest", child.Digest)
+			}
+			continue
+		}
+		childRef := artifactRef{Host: host, Repository: index.Repository, Digest: child.Digest}
+		desc := child
+		desc.Platform = nil
+		if _, err := pushRestoreItem(ctx, registry, childRef, restoreItem{Source: index.Source, Layout: &desc}); err != nil {
+			return fmt.Errorf("failed to push child %s: %w", child.Digest, err)
+		}
+	}
+
+	if err := registry.putManifest(ctx, host, index.Repository, index.Digest, mediaType, indexBytes); err != nil {
+		return err
+	}
+	for _, tag := range index.Tags {
+		if err := registry.putManifest(ctx, host, index.Repository, tag, mediaType, indexBytes); err != nil {
+			return fmt.Errorf("failed to tag %s as %s: %w", ref, tag, err)
+		}
+	}
+	return nil
+}
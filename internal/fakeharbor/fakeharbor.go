@@ -0,0 +1,683 @@
+// Package fakeharbor 是测试用的进程内 Harbor(基于 net/http/httptest)：
+// Harbor v2.0 API(ping、health、statistics，分页的项目、仓库和制品列表，项目的检查和创建)、
+// registry /v2/ 接口(清单和 blob 的拉取与推送，Basic 认证或像真实 Harbor 一样通过 /service/token 的 Bearer 认证)，以及模拟 docker 等容器运行时命令的 shim 脚本。
+package fakeharbor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// 媒体类型
+const (
+	mediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeConfig       = "application/vnd.docker.container.image.v1+json"
+	mediaTypeLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// 默认的凭据
+const (
+	Username = "admin"
+	Password = "Harbor12345"
+)
+
+// Harbor 未指定 page_size 时每页的数量
+const defaultPageSize = 10
+
+// 制品和仓库时间的起点，每次推送向后推一秒，时间只增不减
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Server 是一个进程内的 Harbor，可以在多个 goroutine 中同时使用
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	projects     []harbor.Project
+	repositories map[string][]harbor.Repository // 项目名 -> 仓库
+	artifacts    map[string][]harbor.Artifact   // 仓库名 -> 制品
+	manifests    map[string]manifest            // digest -> 清单
+	blobs        map[string][]byte              // digest -> blob
+	tags         map[string]map[string]string   // 仓库名 -> tag -> 清单 digest
+	requests     map[string]int                 // "GET /path" -> 次数
+	queries      map[string][]url.Values        // "GET /path" -> 每个请求的查询参数
+	failures     map[string]int                 // "GET /path" -> 还要返回 503 的次数
+	tokenAuth    bool                           // registry 使用 Bearer token 认证
+	tokens       map[string]string              // 已签发的 token -> scope
+	nextID       int
+	clock        int
+}
+
+type manifest struct {
+	MediaType string
+	Body      []byte
+}
+
+// New 启动一个空的 Harbor，测试结束时调用 Close
+func New() *Server {
+	s := &Server{
+		repositories: make(map[string][]harbor.Repository),
+		artifacts:    make(map[string][]harbor.Artifact),
+		manifests:    make(map[string]manifest),
+		blobs:        make(map[string][]byte),
+		tags:         make(map[string]map[string]string),
+		requests:     make(map[string]int),
+		queries:      make(map[string][]url.Values),
+		failures:     make(map[string]int),
+		tokens:       make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewTokenAuth 与 New 相同，但 registry 像真实 Harbor 一样返回 Bearer 质询：
+// 客户端用 Basic 凭据向 /service/token 换取 scope 对应的 token
+func NewTokenAuth() *Server {
+	s := New()
+	s.tokenAuth = true
+	return s
+}
+
+// RevokeTokens 作废已签发的全部 token，之后带旧 token 的请求返回 401，模拟 token 过期
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]string)
+}
+
+// BaseURL 返回 API 地址，即 HARBOR_BASEURL
+func (s *Server) BaseURL() string {
+	return s.URL + "/api/v2.0"
+}
+
+// Host 返回 Harbor 的地址(不含协议)，即制品 URI 中的 registry 部分
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// Credentials 返回可以访问 Harbor 的凭据
+func (s *Server) Credentials() *harbor.Credentials {
+	return &harbor.Credentials{Type: harbor.AuthTypeBasic, Username: Username, Password: Password}
+}
+
+// URI 返回制品的 URI，格式与 fetchAllArtifactsWithTypes 相同
+func (s *Server) URI(repository, digest string) string {
+	return fmt.Sprintf("%s/%s@%s", s.Host(), repository, digest)
+}
+
+// Requests 返回 method path(不含查询参数，如 "GET /api/v2.0/projects")收到的请求数
+func (s *Server) Requests(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" "+path]
+}
+
+// Queries 按收到的顺序返回 method path 每个请求的查询参数
+func (s *Server) Queries(method, path string) []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.queries[method+" "+path]...)
+}
+
+// Tag 返回仓库中 tag 指向的清单 digest，包括推送的清单
+func (s *Server) Tag(repository, tag string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest, ok := s.tags[repository][tag]
+	return digest, ok
+}
+
+// Tags 返回仓库中的全部 tag
+func (s *Server) Tags(repository string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tags []string
+	for tag := range s.tags[repository] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Fail 让接下来 times 次 method path 的请求返回 503，模拟临时故障
+func (s *Server) Fail(method, path string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method+" "+path] = times
+}
+
+// AddProject 创建项目，已经存在时不做任何事
+func (s *Server) AddProject(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addProject(name)
+}
+
+func (s *Server) addProject(name string) *harbor.Project {
+	for i := range s.projects {
+		if s.projects[i].Name == name {
+			return &s.projects[i]
+		}
+	}
+	s.nextID++
+	project := harbor.Project{ProjectID: s.nextID, Name: name, CreationTime: s.tick()}
+	project.Metadata.Public = "false"
+	s.projects = append(s.projects, project)
+	return &s.projects[len(s.projects)-1]
+}
+
+// PushImage 推送一个单架构镜像(linux/amd64)到 repository(project/repo)，返回它的 digest
+func (s *Server) PushImage(repository, tag string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest, size := s.putImage(repository, tag, "linux", "amd64")
+	s.addArtifact(repository, harbor.Artifact{Digest: digest, Size: size, ManifestMediaType: mediaTypeManifest}, tag)
+	return digest
+}
+
+// PushIndex 推送一个多架构镜像，platforms 形如 "linux/amd64"；"unknown/unknown" 表示构建证明等附件。
+// 返回清单列表的 digest 和按 platforms 顺序排列的子清单 digest
+func (s *Server) PushIndex(repository, tag string, platforms ...string) (string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type platform struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	}
+	type entry struct {
+		MediaType string   `json:"mediaType"`
+		Digest    string   `json:"digest"`
+		Size      int64    `json:"size"`
+		Platform  platform `json:"platform"`
+	}
+	var entries []entry
+	var references []harbor.Reference
+	var children []string
+	for _, p := range platforms {
+		os, arch, _ := strings.Cut(p, "/")
+		digest, _ := s.putImage(repository, tag, os, arch)
+		children = append(children, digest)
+		entries = append(entries, entry{
+			MediaType: mediaTypeManifest,
+			Digest:    digest,
+			Size:      int64(len(s.manifests[digest].Body)),
+			Platform:  platform{Architecture: arch, OS: os},
+		})
+		references = append(references, harbor.Reference{
+			ChildDigest: digest,
+			Platform:    harbor.Platform{Os: os, Architecture: arch},
+		})
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeManifestList,
+		"manifests":     entries,
+	})
+	digest := sha256Digest(body)
+	s.manifests[digest] = manifest{MediaType: mediaTypeManifestList, Body: body}
+	s.addArtifact(repository, harbor.Artifact{Digest: digest, Size: len(body), ManifestMediaType: mediaTypeManifestList, References: references}, tag)
+	return digest, children
+}
+
+// DeleteArtifact 删除仓库中的制品，清单和 blob 仍然可以拉取
+func (s *Server) DeleteArtifact(repository, digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	artifacts := s.artifacts[repository]
+	for i := range artifacts {
+		if artifacts[i].Digest == digest {
+			s.artifacts[repository] = append(artifacts[:i:i], artifacts[i+1:]...)
+			s.touchRepository(repository, s.tick())
+			return
+		}
+	}
+}
+
+// putImage 生成一个镜像的配置、层和清单，内容由仓库、tag 和平台决定
+func (s *Server) putImage(repository, tag, os, arch string) (string, int) {
+	config, _ := json.Marshal(map[string]string{"architecture": arch, "os": os, "created": s.tick()})
+	layer := []byte(fmt.Sprintf("layer of %s:%s %s/%s", repository, tag, os, arch))
+	s.blobs[sha256Digest(config)] = config
+	s.blobs[sha256Digest(layer)] = layer
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeManifest,
+		"config":        map[string]interface{}{"mediaType": mediaTypeConfig, "digest": sha256Digest(config), "size": len(config)},
+		"layers":        []map[string]interface{}{{"mediaType": mediaTypeLayer, "digest": sha256Digest(layer), "size": len(layer)}},
+	})
+	digest := sha256Digest(body)
+	s.manifests[digest] = manifest{MediaType: mediaTypeManifest, Body: body}
+	return digest, len(config) + len(layer) + len(body)
+}
+
+// addArtifact 把制品加入仓库(仓库和项目不存在时创建)，并更新仓库的 update_time 和 artifact_count
+func (s *Server) addArtifact(repository string, artifact harbor.Artifact, tag string) {
+	projectName, _, _ := strings.Cut(repository, "/")
+	project := s.addProject(projectName)
+	now := s.tick()
+
+	repo := s.repository(repository)
+	if repo == nil {
+		s.nextID++
+		s.repositories[projectName] = append(s.repositories[projectName], harbor.Repository{
+			ID: s.nextID, ProjectID: project.ProjectID, Name: repository, CreationTime: now,
+		})
+		project.RepoCount++
+		repo = s.repository(repository)
+	}
+
+	s.nextID++
+	artifact.ID = s.nextID
+	artifact.ProjectID = project.ProjectID
+	artifact.RepositoryID = repo.ID
+	artifact.PushTime = now
+	artifact.Type = "IMAGE"
+	artifact.MediaType = mediaTypeConfig
+	if tag != "" {
+		artifact.Tags = []harbor.Tag{{Name: tag, RepositoryID: repo.ID, ArtifactID: artifact.ID, PushTime: now}}
+		s.setTag(repository, tag, artifact.Digest)
+	}
+	for i := range artifact.References {
+		artifact.References[i].ParentID = artifact.ID
+	}
+	s.artifacts[repository] = append(s.artifacts[repository], artifact)
+	s.touchRepository(repository, now)
+}
+
+func (s *Server) setTag(repository, tag, digest string) {
+	if s.tags[repository] == nil {
+		s.tags[repository] = make(map[string]string)
+	}
+	s.tags[repository][tag] = digest
+}
+
+// touchRepository 更新仓库的 update_time 和 artifact_count
+func (s *Server) touchRepository(repository, now string) {
+	if repo := s.repository(repository); repo != nil {
+		repo.UpdateTime = now
+		repo.ArtifactCount = len(s.artifacts[repository])
+	}
+}
+
+func (s *Server) repository(name string) *harbor.Repository {
+	projectName, _, _ := strings.Cut(name, "/")
+	repositories := s.repositories[projectName]
+	for i := range repositories {
+		if repositories[i].Name == name {
+			return &repositories[i]
+		}
+	}
+	return nil
+}
+
+// tick 返回下一个时间点，格式与 Harbor 相同
+func (s *Server) tick() string {
+	s.clock++
+	return epoch.Add(time.Duration(s.clock) * time.Second).Format("2006-01-02T15:04:05.000Z")
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	key := r.Method + " " + r.URL.Path
+	s.requests[key]++
+	s.queries[key] = append(s.queries[key], r.URL.Query())
+	fail := s.failures[key] > 0
+	if fail {
+		s.failures[key]--
+	}
+	s.mu.Unlock()
+	if fail {
+		writeError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "injected failure")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/v2.0/"):
+		s.serveAPI(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v2/"):
+		s.serveRegistry(w, r)
+	case r.URL.Path == "/service/token" && s.tokenAuth:
+		s.serveToken(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// authorized 检查请求是否带有正确的 Basic 认证
+func authorized(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	return ok && username == Username && password == Password
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v2.0")
+
+	// ping 和 health 不需要认证
+	switch path {
+	case "/ping":
+		fmt.Fprint(w, "Pong")
+		return
+	case "/health":
+		writeJSON(w, harbor.HealthStatus{Status: "healthy", Components: []harbor.HealthComp{
+			{Name: "core", Status: "healthy"}, {Name: "registry", Status: "healthy"},
+		}})
+		return
+	}
+	if !authorized(r) {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch {
+	case path == "/statistics":
+		stats := harbor.HarborStatistics{TotalProjectCount: len(s.projects), PrivateProjectCount: len(s.projects)}
+		for _, repositories := range s.repositories {
+			stats.TotalRepoCount += len(repositories)
+		}
+		stats.PrivateRepoCount = stats.TotalRepoCount
+		writeJSON(w, stats)
+	case path == "/projects" && r.Method == "HEAD":
+		name := r.URL.Query().Get("project_name")
+		for _, project := range s.projects {
+			if project.Name == name {
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case path == "/projects" && r.Method == "POST":
+		var req struct {
+			ProjectName string `json:"project_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProjectName == "" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid project")
+			return
+		}
+		for _, project := range s.projects {
+			if project.Name == req.ProjectName {
+				writeError(w, http.StatusConflict, "CONFLICT", "project "+req.ProjectName+" already exists")
+				return
+			}
+		}
+		s.addProject(req.ProjectName)
+		w.WriteHeader(http.StatusCreated)
+	case path == "/projects":
+		writePage(w, r, s.projects)
+	case len(parts) == 3 && parts[0] == "projects" && parts[2] == "repositories":
+		repositories, ok := s.repositories[parts[1]]
+		if !ok && !s.hasProject(parts[1]) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "project "+parts[1]+" not found")
+			return
+		}
+		writePage(w, r, repositories)
+	case len(parts) == 5 && parts[0] == "projects" && parts[2] == "repositories" && parts[4] == "artifacts":
+		// 仓库名中的 / 被编码了两次
+		name, err := url.PathUnescape(parts[3])
+		if err == nil {
+			name, err = url.PathUnescape(name)
+		}
+		repository := parts[1] + "/" + name
+		if err != nil || s.repository(repository) == nil {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "repository "+repository+" not found")
+			return
+		}
+		writePage(w, r, s.artifacts[repository])
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+func (s *Server) hasProject(name string) bool {
+	for _, project := range s.projects {
+		if project.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// serveRegistry 实现拉取和推送所需的 /v2/ 接口：/v2/、manifests、blobs 和单次 blob 上传，
+// 使用 Basic 认证，NewTokenAuth 创建的 Harbor 使用 Bearer token
+func (s *Server) serveRegistry(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if s.tokenAuth {
+		if !s.tokenAuthorized(r, path) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/service/token",service="harbor-registry"`, s.URL))
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized to access repository")
+			return
+		}
+	} else if !authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="harbor"`)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+	if path == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		s.serveUpload(w, r, path)
+	case strings.Contains(path, "/manifests/") && r.Method == "PUT":
+		s.putManifest(w, r, path)
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		repository, reference := path[:i], path[i+len("/manifests/"):]
+		if digest, ok := s.tags[repository][reference]; ok {
+			reference = digest
+		}
+		m, ok := s.manifests[reference]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		writeContent(w, r, m.MediaType, m.Body)
+	case strings.Contains(path, "/blobs/"):
+		blob, ok := s.blobs[path[strings.LastIndex(path, "/blobs/")+len("/blobs/"):]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+			return
+		}
+		writeContent(w, r, "application/octet-stream", blob)
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// serveToken 像 Harbor 的 token 服务一样，用 Basic 凭据签发 scope(如 repository:library/nginx:pull)对应的 token
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	token := fmt.Sprintf("token-%d", s.nextID)
+	s.tokens[token] = r.URL.Query().Get("scope")
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"token": token, "expires_in": 1800})
+}
+
+// tokenAuthorized 检查 Bearer token 是否有效，以及它的 scope 是否覆盖请求的仓库和操作；
+// 访问 /v2/ 本身只需要有效的 token
+func (s *Server) tokenAuthorized(r *http.Request, path string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	scope, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if path == "" {
+		return true
+	}
+
+	repository := path
+	for _, marker := range []string{"/manifests/", "/blobs/"} {
+		if i := strings.Index(path, marker); i >= 0 {
+			repository = path[:i]
+			break
+		}
+	}
+	action := "push"
+	if r.Method == "GET" || r.Method == "HEAD" {
+		action = "pull"
+	}
+	parts := strings.Split(scope, ":")
+	if len(parts) != 3 || parts[0] != "repository" || parts[1] != repository {
+		return false
+	}
+	for _, granted := range strings.Split(parts[2], ",") {
+		if granted == action {
+			return true
+		}
+	}
+	return false
+}
+
+// serveUpload 处理 POST <repo>/blobs/uploads/ 和带 digest 参数的 PUT <repo>/blobs/uploads/<id>
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, path string) {
+	switch r.Method {
+	case "POST":
+		s.nextID++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s%d", path, s.nextID))
+		w.WriteHeader(http.StatusAccepted)
+	case "PUT":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		digest := r.URL.Query().Get("digest")
+		if sha256Digest(body) != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+		s.blobs[digest] = body
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// putManifest 保存推送的清单，reference 不是 digest 时记录为 tag；索引的子清单不存在时返回 400
+func (s *Server) putManifest(w http.ResponseWriter, r *http.Request, path string) {
+	i := strings.LastIndex(path, "/manifests/")
+	repository, reference := path[:i], path[i+len("/manifests/"):]
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+	digest := sha256Digest(body)
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match manifest")
+		return
+	}
+	mediaType := r.Header.Get("Content-Type")
+	if mediaType == mediaTypeManifestList || mediaType == "application/vnd.oci.image.index.v1+json" {
+		// 与 Harbor 一样，索引引用的子清单必须已经推送
+		var index struct {
+			Manifests []struct {
+				Digest string `json:"digest"`
+			} `json:"manifests"`
+		}
+		if err := json.Unmarshal(body, &index); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		for _, child := range index.Manifests {
+			if _, ok := s.manifests[child.Digest]; !ok {
+				writeError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "manifest "+child.Digest+" unknown")
+				return
+			}
+		}
+	}
+	s.manifests[digest] = manifest{MediaType: mediaType, Body: body}
+	if !strings.HasPrefix(reference, "sha256:") {
+		s.setTag(repository, reference, digest)
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// writeContent 返回清单或 blob，HEAD 请求只返回头部
+func writeContent(w http.ResponseWriter, r *http.Request, mediaType string, body []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Docker-Content-Digest", sha256Digest(body))
+	if r.Method != "HEAD" {
+		w.Write(body)
+	}
+}
+
+// writePage 按 page 和 page_size 返回一页，并像 Harbor 一样设置 X-Total-Count 和 Link
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+
+	start := (page - 1) * pageSize
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+	if end < len(items) {
+		query.Set("page", strconv.Itoa(page+1))
+		query.Set("page_size", strconv.Itoa(pageSize))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.EscapedPath(), query.Encode()))
+	}
+	writeJSON(w, append([]T{}, items[start:end]...))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 按 Harbor 的格式返回错误：{"errors":[{"code":"...","message":"..."}]}
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package fakeharbor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runtimeShim 模拟 docker、podman、nerdctl 和 skopeo 命令行，本地镜像存储是 images 文件中的镜像列表：
+// pull 把镜像加入列表，image inspect 检查镜像是否在列表中，rmi 把镜像移出列表；
+// save -o FILE IMAGE(镜像必须已在列表中)和 skopeo copy SRC docker-archive:FILE 写出一个假的镜像归档。
+// 每次调用的参数按行追加到日志文件；环境变量 FAKE_RUNTIME_FAIL 等于子命令名(如 save)时该子命令失败
+const runtimeShim = `#!/bin/sh
+echo "$*" >> %q
+if [ -n "$FAKE_RUNTIME_FAIL" ] && [ "$FAKE_RUNTIME_FAIL" = "$1" ]; then
+	echo "Error: injected $1 failure" >&2
+	exit 1
+fi
+images=%q
+has_image() {
+	grep -qxF "$1" "$images" 2>/dev/null
+}
+case "$1" in
+pull)
+	has_image "$2" || echo "$2" >> "$images"
+	;;
+image)
+	if ! has_image "$3"; then
+		echo "Error: No such image: $3" >&2
+		exit 1
+	fi
+	;;
+rmi)
+	if ! has_image "$2"; then
+		echo "Error: No such image: $2" >&2
+		exit 1
+	fi
+	grep -vxF "$2" "$images" > "$images.tmp"
+	mv "$images.tmp" "$images"
+	;;
+save)
+	if ! has_image "$4"; then
+		echo "Error: No such image: $4" >&2
+		exit 1
+	fi
+	printf 'fake image archive of %%s\n' "$4" > "$3"
+	;;
+copy)
+	printf 'fake image archive of %%s\n' "$2" > "${3#docker-archive:}"
+	;;
+esac
+exit 0
+`
+
+// RuntimeFailEnv 设置为子命令名(如 "save")时 shim 执行该子命令会失败
+const RuntimeFailEnv = "FAKE_RUNTIME_FAIL"
+
+// WriteRuntimeShim 在 dir 中写出名为 name(如 docker、skopeo)的可执行脚本，返回记录调用参数的日志路径。
+// 测试把 dir 放在 PATH 的最前面，程序执行 name 时调用的就是这个脚本
+func WriteRuntimeShim(dir, name string) (string, error) {
+	logPath := filepath.Join(dir, name+".log")
+	script := fmt.Sprintf(runtimeShim, logPath, imagesPath(logPath))
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		return "", err
+	}
+	return logPath, nil
+}
+
+// RuntimeCalls 读取 shim 的日志，每次调用一行，如 "pull host/library/nginx@sha256:..."
+func RuntimeCalls(logPath string) ([]string, error) {
+	return readLines(logPath)
+}
+
+// RuntimeImages 返回 shim 本地镜像存储中的镜像
+func RuntimeImages(logPath string) ([]string, error) {
+	images, err := readLines(imagesPath(logPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return images, err
+}
+
+// AddRuntimeImage 把镜像放入 shim 的本地镜像存储，模拟运行前已经拉取过的镜像
+func AddRuntimeImage(logPath, image string) error {
+	f, err := os.OpenFile(imagesPath(logPath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(image + "\n")
+	return err
+}
+
+// imagesPath 返回与日志文件放在一起的镜像列表文件
+func imagesPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".log") + ".images"
+}
+
+// readLines 按行读取文件，空文件返回 nil
+func readLines(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"harbor_api_mario/harbor"
+)
+
+// fetchInventory 获取 Harbor 快照：使用 -use-cache / -refresh 时从本地缓存读取或增量刷新(见 inventory_cache.go)，
+// 否则完整遍历一次 Harbor。uris、pull、save 和各种备份都基于它生成 URI，不再重复查询项目和仓库列表。
+// skipArtifacts 对某个仓库返回 true 时不查询它的制品(如增量备份中没有变化的仓库)，为 nil 时查询全部仓库
+func fetchInventory(ctx context.Context, client *harbor.Client, skipArtifacts func(harbor.Repository) bool) (*harbor.Inventory, error) {
+	if inventoryCacheMode != inventoryCacheOff {
+		return fetchCachedInventory(ctx, client, skipArtifacts)
+	}
+	return client.Inventory(ctx, harbor.InventoryOptions{SkipArtifacts: skipArtifacts})
+}
+
+// inventoryURIs 按架构类型分类的 URI 列表，键与 fetchAllArtifactsWithTypes 的返回值相同
+func inventoryURIs(inv *harbor.Inventory) (map[string][]string, error) {
+	// 初始化存储 URI 列表的 map
+	uriMap := map[string][]string{
+		"single_architecture":   {},
+		"multi_architecture":    {},
+		"multi_arch_with_child": {},
+		"all_uris":              {},
+		"non_unknown_arch_uris": {},
+		"unknown_arch_uris":     {},
+	}
+
+	// 遍历所有制品
+	for _, artifact := range inv.AllArtifacts() {
+		// 根据制品的 RepositoryID 获取 RepositoryName
+		repository, ok := inv.Repository(artifact.RepositoryID)
+		if !ok {
+			return nil, fmt.Errorf("repository name not found for repository ID: %d", artifact.RepositoryID)
+		}
+		repoName := repository.Name
+
+		if len(artifact.References) == 0 {
+			// 单架构制品
+			uri := fmt.Sprintf("%s/%s@%s", inv.Host, repoName, artifact.Digest)
+			uriMap["single_architecture"] = append(uriMap["single_architecture"], uri)
+			uriMap["all_uris"] = append(uriMap["all_uris"], uri)
+			uriMap["non_unknown_arch_uris"] = append(uriMap["non_unknown_arch_uris"], uri)
+		} else {
+			// 多架构制品
+			uri := fmt.Sprintf("%s/%s@%s", inv.Host, repoName, artifact.Digest)
+			uriMap["multi_architecture"] = append(uriMap["multi_architecture"], uri)
+
+			for _, reference := range artifact.References {
+				childURI := fmt.Sprintf("%s/%s@%s::%s", inv.Host, repoName, artifact.Digest, reference.ChildDigest)
+				uriMap["multi_arch_with_child"] = append(uriMap["multi_arch_with_child"], childURI)
+
+				childDigestURI := fmt.Sprintf("%s/%s@%s", inv.Host, repoName, reference.ChildDigest)
+
+				if reference.Platform.Architecture != "unknown" && reference.Platform.Os != "unknown" {
+					uriMap["non_unknown_arch_uris"] = append(uriMap["non_unknown_arch_uris"], childDigestURI)
+				} else {
+					uriMap["unknown_arch_uris"] = append(uriMap["unknown_arch_uris"], childDigestURI)
+				}
+
+				uriMap["all_uris"] = append(uriMap["all_uris"], childDigestURI)
+			}
+		}
+	}
+
+	return uriMap, nil
+}
+
+// inventoryBackupArtifacts 把快照中仓库的制品转换为备份清单中的制品(与 non_unknown_arch_uris 相同)
+func inventoryBackupArtifacts(inv *harbor.Inventory, repository harbor.Repository) []BackupArtifact {
+	var backupArtifacts []BackupArtifact
+	for _, artifact := range inv.Artifacts[repository.ID] {
+		backupArtifacts = append(backupArtifacts, toBackupArtifacts(inv.Host, repository.Name, artifact)...)
+	}
+	return backupArtifacts
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// 本地清单缓存文件名，默认放在备份根目录中
+const inventoryCacheFile = "inventory_cache.json"
+
+// 清单缓存的使用方式
+const (
+	inventoryCacheOff     = ""        // 不使用缓存，每次完整遍历 Harbor
+	inventoryCacheUse     = "use"     // 直接使用缓存，不查询 Harbor；还没有缓存时遍历一次并写入缓存
+	inventoryCacheRefresh = "refresh" // 重新查询项目和仓库，只为有变化的仓库查询制品，并更新缓存
+)
+
+// 清单缓存的设置，main 根据 -use-cache、-refresh、-cache-file 修改
+var (
+	inventoryCacheMode = inventoryCacheOff
+	inventoryCachePath string
+)
+
+// inventoryCache 是缓存文件的内容
+type inventoryCache struct {
+	BaseURL   string            `json:"base_url"`   // 缓存对应的 Harbor API 地址，与当前地址不同时不使用
+	UpdatedAt string            `json:"updated_at"` // 最近一次查询 Harbor 的时间
+	Inventory *harbor.Inventory `json:"inventory"`
+}
+
+// fetchCachedInventory 按 inventoryCacheMode 从缓存读取快照或增量刷新缓存
+func fetchCachedInventory(ctx context.Context, client *harbor.Client, skipArtifacts func(harbor.Repository) bool) (*harbor.Inventory, error) {
+	cache, err := readInventoryCache(inventoryCachePath, client.BaseURL())
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil && inventoryCacheMode == inventoryCacheUse && inventoryComplete(cache.Inventory, skipArtifacts) {
+		fmt.Printf("Using inventory cache %s from %s, run with -refresh to update it\n", inventoryCachePath, cache.UpdatedAt)
+		return cache.Inventory, nil
+	}
+
+	var previous *harbor.Inventory
+	if cache != nil {
+		previous = cache.Inventory
+	}
+	inv, err := client.Inventory(ctx, harbor.InventoryOptions{SkipArtifacts: skipArtifacts, Previous: previous})
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		fmt.Printf("Inventory refreshed: %d repositories, artifacts listed for %d changed or new repositories\n", len(inv.Repositories), inv.ArtifactsListed)
+	}
+	if err := writeInventoryCache(inventoryCachePath, client.BaseURL(), inv); err != nil {
+		return nil, fmt.Errorf("failed to write inventory cache: %w", err)
+	}
+	return inv, nil
+}
+
+// readInventoryCache 读取缓存文件，文件不存在或属于其他 Harbor 时返回 nil
+func readInventoryCache(path, baseURL string) (*inventoryCache, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory cache: %w", err)
+	}
+	var cache inventoryCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("invalid inventory cache %s: %v", path, err)
+	}
+	if cache.BaseURL != baseURL {
+		fmt.Printf("Inventory cache %s belongs to %s, ignoring it\n", path, cache.BaseURL)
+		return nil, nil
+	}
+	if cache.Inventory == nil {
+		return nil, nil
+	}
+	if cache.Inventory.Artifacts == nil {
+		cache.Inventory.Artifacts = map[int][]harbor.Artifact{}
+	}
+	return &cache, nil
+}
+
+// inventoryComplete 判断快照中是否有所有需要的仓库的制品；增量备份只查询有变化的仓库时写入的缓存缺少其他仓库的制品
+func inventoryComplete(inv *harbor.Inventory, skipArtifacts func(harbor.Repository) bool) bool {
+	for _, repository := range inv.Repositories {
+		if _, ok := inv.Artifacts[repository.ID]; !ok && (skipArtifacts == nil || !skipArtifacts(repository)) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeInventoryCache 写出缓存文件
+func writeInventoryCache(path, baseURL string, inv *harbor.Inventory) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(inventoryCache{
+		BaseURL:   baseURL,
+		UpdatedAt: time.Now().Format(time.RFC3339),
+		Inventory: inv,
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// listProjects 获取项目列表，使用缓存时取自缓存的快照
+func listProjects(ctx context.Context, client *harbor.Client) ([]harbor.Project, error) {
+	if inventoryCacheMode == inventoryCacheOff {
+		return client.ListProjects(ctx, nil)
+	}
+	inv, err := fetchInventory(ctx, client, nil)
+	if err != nil {
+		return nil, err
+	}
+	return inv.Projects, nil
+}
+
+// listRepositories 获取仓库列表，使用缓存时取自缓存的快照
+func listRepositories(ctx context.Context, client *harbor.Client) ([]harbor.Repository, error) {
+	if inventoryCacheMode == inventoryCacheOff {
+		return client.ListAllRepositories(ctx)
+	}
+	inv, err := fetchInventory(ctx, client, nil)
+	if err != nil {
+		return nil, err
+	}
+	return inv.Repositories, nil
+}
+
+// listArtifacts 获取全部制品，使用缓存时取自缓存的快照
+func listArtifacts(ctx context.Context, client *harbor.Client) ([]harbor.Artifact, error) {
+	inv, err := fetchInventory(ctx, client, nil)
+	if err != nil {
+		return nil, err
+	}
+	return inv.AllArtifacts(), nil
+}
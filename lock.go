@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 备份根目录中的锁文件
+const backupLockFile = ".lock"
+
+// lockBackupRoot 对备份根目录加排他锁，防止两个备份或清理同时写同一个根目录
+// 返回的函数用于释放锁；进程退出时操作系统也会释放锁
+func lockBackupRoot(root string) (func(), error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup root: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(root, backupLockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("backup root %s is in use by another run: %v", root, err)
+	}
+
+	// 记录持有锁的进程，方便排查
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
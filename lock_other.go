@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile 在不支持 flock 的平台上不加锁
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -4,32 +4,202 @@ import (
 	"flag"
 	"fmt"
 	"os"
-)
+	"strings"
+	"time"
 
-const (
-	DefaultPageSize = 10
-	MaxPageSize     = 100
+	"harbor_api_mario/harbor"
 )
 
 func main() {
-	// 从环境变量中获取 harbor host 和认证信息
-	baseURL := os.Getenv("HARBOR_BASEURL")
-	auth := os.Getenv("HARBOR_AUTH")
-	if baseURL == "" || auth == "" {
-		fmt.Println("Error: HARBOR_BASEURL or HARBOR_AUTH environment variables are not set.")
-		return
-	}
-
 	// 定义命令行选项
 	action := flag.String("action", "", "Action to perform: "+
 		"ping , health , statistics , projects , repositories , artifacts , uris , "+
-		"pull , save, full_backup , delta_backup")
+		"pull , save, full_backup , delta_backup , incremental_backup , restore , verify , prune")
+	pullerName := flag.String("puller", "native", "How artifacts are fetched for save and backups: "+
+		"native (registry /v2/ API, no Docker daemon) , docker , podman , nerdctl (pull + save with that CLI) , "+
+		"skopeo (skopeo copy to docker-archive, no daemon); pull uses docker unless docker, podman or nerdctl is given")
+	keepImagesFlag := flag.Bool("keep-images", false, "For save and backups with -puller docker, podman or nerdctl: keep the images this run pulls "+
+		"in the local image store as a warm cache (default: remove them once each save finishes, whether it succeeded or not; images that were already present are never removed)")
+	backupFormat := flag.String("format", "tar", "Backup format for full_backup, delta_backup and incremental_backup: "+
+		"tar (one docker-loadable tar per URI) , oci (one OCI image layout per backup directory, blobs stored once)")
+	configPath := flag.String("config", "", "JSON config file, e.g. {\"backup_root\": \"/data/harbor_backups/artifacts\"} (default: HARBOR_CONFIG)")
+	backupRootFlag := flag.String("backup-root", "", "Directory that holds backups, the last full backup state file and the backup index "+
+		"(default: HARBOR_BACKUP_ROOT, backup_root in the config file, or ./artifacts)")
+	backupDir := flag.String("backup-dir", "", "Backup directory to restore or verify, either a path or a directory name inside the backup root")
+	targetURL := flag.String("target-url", "", "Harbor API URL to restore into (default: HARBOR_BASEURL)")
+	targetAuth := flag.String("target-auth", "", "Auth for the restore target, same format as HARBOR_AUTH or a full Authorization header such as \"Bearer <token>\" (default: the source credentials)")
+	projectFilter := flag.String("project", "", "Comma-separated project name patterns to restore, e.g. library,team-*")
+	repoFilter := flag.String("repo", "", "Comma-separated repository patterns (project/repo) to restore, e.g. library/nginx")
+	dryRun := flag.Bool("dry-run", false, "For restore and prune: print what would be pushed or removed without changing anything")
+	changedReposOnly := flag.Bool("changed-repos-only", false, "For delta_backup and incremental_backup: only list artifacts of repositories updated after the newest push time recorded in the base backup")
+	resumeDir := flag.String("resume", "", "For full_backup, delta_backup and incremental_backup: continue an interrupted backup in this directory instead of starting a new one")
+	drift := flag.Bool("drift", false, "For verify: also compare the backup with the artifacts currently in Harbor")
+	keepLastFull := flag.Int("keep-last-full", 0, "For prune: keep the N most recent full backups")
+	keepDaily := flag.Int("keep-daily", 0, "For prune: keep the newest backup of each of the last N days that have backups")
+	keepWeekly := flag.Int("keep-weekly", 0, "For prune: keep the newest backup of each of the last N weeks that have backups")
+	keepMonthly := flag.Int("keep-monthly", 0, "For prune: keep the newest backup of each of the last N months that have backups")
+	keepDays := flag.Int("keep-days", 0, "For prune: keep every backup made in the last N days")
+	timeout := flag.Duration("timeout", 0, "Timeout of a single Harbor API request; for registry blob transfers only the wait for response headers (default 60s)")
+	caCert := flag.String("ca-cert", "", "PEM file with extra CA certificates to trust, e.g. an internal CA")
+	clientCert := flag.String("client-cert", "", "PEM client certificate for mutual TLS, used with --client-key")
+	clientKey := flag.String("client-key", "", "PEM private key of --client-cert")
+	insecure := flag.Bool("insecure", false, "Skip TLS certificate verification (testing only)")
+	proxy := flag.String("proxy", "", "HTTP(S) proxy URL (default: HTTPS_PROXY / HTTP_PROXY / NO_PROXY)")
+	apiRPS := flag.Float64("api-rps", 0, "Maximum Harbor API requests per second, e.g. 5 (default: unlimited; registry blob downloads are not affected)")
+	apiMaxInFlight := flag.Int("api-max-in-flight", 0, "Maximum concurrent Harbor API requests (default: unlimited)")
+	crawlWorkers := flag.Int("crawl-concurrency", 0, "How many projects or repositories are listed concurrently when collecting repositories and artifacts "+
+		"(default: crawl_concurrency in the config file, or 8)")
+	useCache := flag.Bool("use-cache", false, "For projects, repositories, artifacts, uris, save and backups: use the local inventory cache instead of listing Harbor "+
+		"(the first run lists Harbor and writes the cache)")
+	refreshCache := flag.Bool("refresh", false, "Update the local inventory cache: list projects and repositories again and artifacts only of repositories whose update time or artifact count changed")
+	cacheFile := flag.String("cache-file", "", "Inventory cache file (default: cache_file in the config file, or inventory_cache.json in the backup root)")
+	maxBandwidth := flag.String("max-bandwidth", "", "Aggregate download bandwidth of all artifact pulls with the native puller, e.g. 200MB/s or 50MiB/s (default: unlimited)")
+	bandwidthSchedule := flag.String("bandwidth-schedule", "", "Comma-separated local time windows in which --max-bandwidth applies, e.g. \"mon-fri 08:00-19:00\"; "+
+		"outside them downloads are not limited (default: always)")
+	credentialsFile := flag.String("credentials-file", "", "JSON credentials file, e.g. {\"type\": \"robot\", \"username\": \"backup\", \"password\": \"<secret>\"}; "+
+		"type is basic, robot, oidc (password is the CLI secret) or bearer (with token) (default: HARBOR_CREDENTIALS_FILE or credentials_file in the config file)")
+	dockerConfig := flag.String("docker-config", "", "docker config.json to take credentials for the Harbor host from when no other credentials are given "+
+		"(default: $DOCKER_CONFIG/config.json or ~/.docker/config.json)")
+	retries := flag.Int("retries", 3, "How many times a failed Harbor API GET or artifact download is retried (0 disables retries)")
+	retryDelay := flag.Duration("retry-delay", time.Second, "Wait before the first retry, doubled for every further retry (with jitter, capped at 1m); Retry-After from Harbor takes precedence")
 	flag.Parse()
 
+	// 备份根目录：命令行参数 > 环境变量 > 配置文件 > ./artifacts
+	if *configPath == "" {
+		*configPath = os.Getenv("HARBOR_CONFIG")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(2)
+	}
+	backupRoot, err := resolveBackupRoot(*backupRootFlag, cfg)
+	if err != nil {
+		fmt.Printf("Error resolving backup root: %v\n", err)
+		os.Exit(2)
+	}
+	*backupDir = resolveBackupDir(backupRoot, *backupDir)
+	*resumeDir = resolveBackupDir(backupRoot, *resumeDir)
+
+	// 所有请求共用一个 HTTP 客户端：超时、CA、客户端证书、代理
+	httpOpts, err := resolveHTTPClientOptions(httpClientOptions{
+		Timeout:  *timeout,
+		CAFile:   *caCert,
+		CertFile: *clientCert,
+		KeyFile:  *clientKey,
+		Insecure: *insecure,
+		Proxy:    *proxy,
+
+		APIRequestsPerSecond: *apiRPS,
+		APIMaxInFlight:       *apiMaxInFlight,
+	}, cfg)
+	var clientOpts harbor.Options
+	if err == nil {
+		clientOpts, err = configureHTTPClients(httpOpts)
+	}
+	if err != nil {
+		fmt.Printf("Error configuring HTTP client: %v\n", err)
+		os.Exit(2)
+	}
+
+	// 并发查询仓库和制品列表
+	if *crawlWorkers == 0 {
+		*crawlWorkers = cfg.CrawlConcurrency
+	}
+	if *crawlWorkers < 0 {
+		fmt.Println("Error: --crawl-concurrency must not be negative.")
+		os.Exit(2)
+	}
+	clientOpts.Concurrency = *crawlWorkers
+
+	// 本地清单缓存：-use-cache 直接使用，-refresh 增量更新
+	switch {
+	case *refreshCache:
+		inventoryCacheMode = inventoryCacheRefresh
+	case *useCache:
+		inventoryCacheMode = inventoryCacheUse
+	}
+	inventoryCachePath = resolveInventoryCachePath(*cacheFile, backupRoot, cfg)
+
+	// 制品下载的总带宽限制，可以只在工作时间生效
+	downloadLimiter, err = resolveBandwidthLimiter(*maxBandwidth, *bandwidthSchedule, cfg)
+	if err != nil {
+		fmt.Printf("Error configuring bandwidth limit: %v\n", err)
+		os.Exit(2)
+	}
+
+	// 容器运行时为备份拉取的镜像在保存后删除，避免占满备份主机的磁盘
+	keepImages = *keepImagesFlag
+
+	// 幂等 API 请求和制品下载的重试策略，运行结束时汇总重试情况
+	if *retries < 0 {
+		fmt.Println("Error: --retries must not be negative.")
+		os.Exit(2)
+	}
+	defaultRetryPolicy.MaxAttempts = *retries + 1
+	defaultRetryPolicy.BaseDelay = *retryDelay
+	clientOpts.Retry = defaultRetryPolicy
+	// 收到第一次停止信号后不再发起新的 API 请求
+	clientOpts.BeforeRequest = checkInterrupted
+
+	// SIGINT/SIGTERM：第一次停止开始新的工作并等待正在保存的制品，第二次中止它们
+	ctx, stopSignals, interrupted := handleShutdownSignals()
+	defer exitIfInterrupted(interrupted)
+	defer stopSignals()
+	defer printRetrySummary()
+
+	// 从环境变量中获取 harbor host，凭据按 环境变量 > 凭据文件 > docker config.json 查找；
+	// 只读取本地备份的操作不需要
+	baseURL := os.Getenv("HARBOR_BASEURL")
+	localOnly := (*action == "verify" && !*drift) || *action == "prune"
+	var client *harbor.Client
+	var creds *credentials
+	if !localOnly {
+		if baseURL == "" {
+			fmt.Println("Error: HARBOR_BASEURL environment variable is not set.")
+			return
+		}
+		if *credentialsFile == "" {
+			*credentialsFile = os.Getenv("HARBOR_CREDENTIALS_FILE")
+		}
+		if *credentialsFile == "" {
+			*credentialsFile = cfg.CredentialsFile
+		}
+		if *dockerConfig == "" {
+			*dockerConfig = cfg.DockerConfig
+		}
+		creds, err = resolveCredentials(baseURL, *credentialsFile, *dockerConfig)
+		if err != nil {
+			fmt.Printf("Error loading credentials: %v\n", err)
+			os.Exit(2)
+		}
+		if creds == nil {
+			fmt.Println("Error: no Harbor credentials found. Set HARBOR_USERNAME and HARBOR_PASSWORD, HARBOR_TOKEN or HARBOR_AUTH, " +
+				"use --credentials-file, or docker login to the Harbor host.")
+			return
+		}
+		client, err = harbor.NewClient(baseURL, &creds.Credentials, clientOpts)
+		if err != nil {
+			fmt.Printf("Error creating Harbor client: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// 写备份根目录的操作同一时间只能运行一个
+	switch *action {
+	case "save", "full_backup", "delta_backup", "incremental_backup", "prune":
+		release, err := lockBackupRoot(backupRoot)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer release()
+	}
+
 	switch *action {
 	case "ping":
 		// 检查 Harbor 是否可用
-		isAlive, err := CheckHarborPing(baseURL)
+		isAlive, err := checkHarborPing(ctx, client)
 		if err != nil {
 			fmt.Println("Error checking Harbor availability:", err)
 			return
@@ -41,7 +211,7 @@ func main() {
 		}
 	case "health":
 		// 检查 Harbor API 健康状态
-		isHealthy, err := CheckHarborHealth(baseURL)
+		isHealthy, err := checkHarborHealth(ctx, client)
 		if err != nil {
 			fmt.Println("Error checking Harbor health:", err)
 			return
@@ -53,16 +223,16 @@ func main() {
 		}
 	case "statistics":
 		// 获取 Harbor 统计信息
-		stats, err := GetHarborStatistics(baseURL, auth)
+		stats, err := client.Statistics(ctx)
 		if err != nil {
 			fmt.Println("Error getting Harbor statistics:", err)
 			return
 		}
 		// 输出统计信息
-		PrintHarborStatistics(stats)
+		printHarborStatistics(stats)
 	case "projects":
 		// 获取 Harbor 所有项目列表
-		projects, err := fetchAllProjects(baseURL, auth)
+		projects, err := listProjects(ctx, client)
 		if err != nil {
 			fmt.Printf("Error fetching projects: %v\n", err)
 			return
@@ -71,7 +241,7 @@ func main() {
 		printProjects(projects)
 	case "repositories":
 		// 获取 Harbor 所有仓库列表
-		repositories, err := fetchAllRepositories(baseURL, auth)
+		repositories, err := listRepositories(ctx, client)
 		if err != nil {
 			fmt.Printf("Error fetching repositories: %v\n", err)
 			return
@@ -80,7 +250,7 @@ func main() {
 		printRepositories(repositories)
 	case "artifacts":
 		// 获取 Harbor 所有制品列表
-		artifacts, err := fetchAllArtifacts(baseURL, auth)
+		artifacts, err := listArtifacts(ctx, client)
 		if err != nil {
 			fmt.Printf("Error fetching artifacts: %v\n", err)
 			return
@@ -98,7 +268,7 @@ func main() {
 	//	printAllURIs(singleArchURIs, multiArchURIs, multiArchWithChildURIs, allURIs, nonUnknownArchURIs, unknownArchURIs)
 	case "uris":
 		// 获取所有 URI 列表
-		artifactMap, err := fetchAllArtifactsWithTypes(baseURL, auth)
+		artifactMap, err := fetchAllArtifactsWithTypes(ctx, client)
 		if err != nil {
 			fmt.Printf("Error fetching URIs: %v\n", err)
 			return
@@ -106,21 +276,41 @@ func main() {
 		// 打印所有 URI 列表
 		printArtifactsWithTypes(artifactMap)
 	case "pull":
-		// docker pull 所有 URI
-		err := downloadArtifacts(baseURL, auth)
+		// 用 docker / podman / nerdctl pull 所有 URI
+		runtime, err := newPullRuntime(*pullerName)
+		if err != nil {
+			fmt.Printf("Error creating container runtime: %v\n", err)
+			return
+		}
+		err = downloadArtifacts(ctx, client, runtime)
 		if err != nil {
 			fmt.Printf("Error downloading artifacts: %v\n", err)
 			return
 		}
 	case "save":
-		// docker pull and docker save 所有 URI
-		err := downloadAndSaveArtifacts(baseURL, auth)
+		// 拉取并保存所有 URI
+		puller, err := newArtifactPuller(*pullerName, client)
+		if err != nil {
+			fmt.Printf("Error creating puller: %v\n", err)
+			return
+		}
+		err = downloadAndSaveArtifacts(ctx, client, puller, backupRoot)
 		if err != nil {
 			fmt.Printf("Error downloading and saving artifacts: %v\n", err)
 		}
 	case "full_backup":
 		// 全量备份
-		err := downloadAndSaveAllArtifacts(baseURL, auth)
+		puller, err := newArtifactPuller(*pullerName, client)
+		if err != nil {
+			fmt.Printf("Error creating puller: %v\n", err)
+			return
+		}
+		opts := backupOptions{Root: backupRoot, Puller: puller, Format: *backupFormat}
+		if *resumeDir != "" {
+			err = resumeBackup(ctx, *resumeDir, opts)
+		} else {
+			err = downloadAndSaveAllArtifacts(ctx, client, opts)
+		}
 		if err != nil {
 			fmt.Printf("Error in full backup: %v\n", err)
 			return
@@ -128,15 +318,142 @@ func main() {
 		fmt.Println("Full backup completed successfully.")
 	case "delta_backup":
 		// 差量备份
-		err := downloadAndSaveDeltaArtifacts(baseURL, auth)
+		puller, err := newArtifactPuller(*pullerName, client)
+		if err != nil {
+			fmt.Printf("Error creating puller: %v\n", err)
+			return
+		}
+		opts := backupOptions{Root: backupRoot, Puller: puller, Format: *backupFormat, ChangedReposOnly: *changedReposOnly}
+		if *resumeDir != "" {
+			err = resumeBackup(ctx, *resumeDir, opts)
+		} else {
+			err = downloadAndSaveDeltaArtifacts(ctx, client, opts)
+		}
 		if err != nil {
 			fmt.Printf("Error in delta backup: %v\n", err)
 			return
 		}
 		fmt.Println("Delta backup completed successfully.")
+	case "incremental_backup":
+		// 增量备份
+		puller, err := newArtifactPuller(*pullerName, client)
+		if err != nil {
+			fmt.Printf("Error creating puller: %v\n", err)
+			return
+		}
+		opts := backupOptions{Root: backupRoot, Puller: puller, Format: *backupFormat, ChangedReposOnly: *changedReposOnly}
+		if *resumeDir != "" {
+			err = resumeBackup(ctx, *resumeDir, opts)
+		} else {
+			err = downloadAndSaveIncrementalArtifacts(ctx, client, opts)
+		}
+		if err != nil {
+			fmt.Printf("Error in incremental backup: %v\n", err)
+			return
+		}
+		fmt.Println("Incremental backup completed successfully.")
+	case "restore":
+		// 从备份目录恢复到 Harbor
+		if *backupDir == "" {
+			fmt.Println("Error: --backup-dir is required for restore.")
+			return
+		}
+		opts := restoreOptions{
+			BackupDir:    *backupDir,
+			Target:       client,
+			Projects:     splitList(*projectFilter),
+			Repositories: splitList(*repoFilter),
+			DryRun:       *dryRun,
+		}
+		// 恢复到另一个 Harbor 或使用另一组凭据时单独创建客户端
+		if *targetURL != "" || *targetAuth != "" {
+			target, err := newTargetClient(baseURL, creds, *targetURL, *targetAuth, clientOpts)
+			if err != nil {
+				fmt.Printf("Error creating restore target client: %v\n", err)
+				return
+			}
+			opts.Target = target
+		}
+		err := restoreBackup(ctx, opts)
+		if err != nil {
+			fmt.Printf("Error in restore: %v\n", err)
+			return
+		}
+		if !opts.DryRun {
+			fmt.Println("Restore completed successfully.")
+		}
+	case "verify":
+		// 校验备份完整性，发现问题时以非零状态退出
+		if *backupDir == "" {
+			fmt.Println("Error: --backup-dir is required for verify.")
+			os.Exit(2)
+		}
+		problems, err := verifyBackup(ctx, verifyOptions{BackupDir: *backupDir, Drift: *drift, Client: client})
+		if err != nil {
+			fmt.Printf("Error verifying backup: %v\n", err)
+			os.Exit(1)
+		}
+		if len(problems) > 0 {
+			printVerifyProblems(problems)
+			os.Exit(1)
+		}
+		fmt.Println("Backup verified successfully.")
+	case "prune":
+		// 按保留策略清理旧备份，不会删除被保留备份依赖的全量备份
+		opts := pruneOptions{
+			Root:         backupRoot,
+			KeepLastFull: *keepLastFull,
+			KeepDaily:    *keepDaily,
+			KeepWeekly:   *keepWeekly,
+			KeepMonthly:  *keepMonthly,
+			KeepDays:     *keepDays,
+			DryRun:       *dryRun,
+		}
+		err := pruneBackups(opts)
+		if err != nil {
+			fmt.Printf("Error pruning backups: %v\n", err)
+			os.Exit(1)
+		}
 	default:
 		fmt.Println("Invalid action. Please choose one of: " +
 			"ping , health , statistics , projects , repositories , artifacts , uris , " +
-			"pull , save  , full_backup , delta_backup")
+			"pull , save  , full_backup , delta_backup , incremental_backup , restore , verify , prune")
+	}
+}
+
+// exitIfInterrupted 收到停止信号时以 130 退出，便于脚本和 systemd 区分被中断的运行
+// 在 stopSignals 之后执行，此时 context 已被取消，只能根据是否收到过信号判断
+func exitIfInterrupted(interrupted func() bool) {
+	if interrupted() {
+		fmt.Println("Stopped by signal.")
+		os.Exit(130)
+	}
+}
+
+// splitList 解析逗号分隔的命令行参数，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newTargetClient 创建恢复目标的客户端，没有指定的地址或凭据沿用源 Harbor 的
+func newTargetClient(baseURL string, creds *credentials, targetURL, targetAuth string, opts harbor.Options) (*harbor.Client, error) {
+	if targetURL == "" {
+		targetURL = baseURL
+	}
+	if targetAuth != "" {
+		var err error
+		if creds, err = credentialsFromAuth(targetAuth, "--target-auth"); err != nil {
+			return nil, err
+		}
+		if err := creds.normalize(); err != nil {
+			return nil, err
+		}
 	}
+	return harbor.NewClient(targetURL, &creds.Credentials, opts)
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"harbor_api_mario/internal/fakeharbor"
+)
+
+// 设置 HARBOR_TEST_RUN_MAIN 时测试二进制直接运行 main，用于检查命令行的退出码
+func TestMain(m *testing.M) {
+	if os.Getenv("HARBOR_TEST_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain 在子进程中运行 main，返回退出码和输出
+func runMain(t *testing.T, env []string, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "HARBOR_TEST_RUN_MAIN=1", "HARBOR_CONFIG=", "HARBOR_BACKUP_ROOT=")
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(output)
+	}
+	if err != nil {
+		t.Fatalf("running main: %v", err)
+	}
+	return 0, string(output)
+}
+
+func TestMainExitsZeroWithoutSignal(t *testing.T) {
+	fake, _ := newFakeHarbor(t)
+	fake.PushImage("library/nginx", "1.25")
+	harborEnv := []string{
+		"HARBOR_BASEURL=" + fake.BaseURL(),
+		"HARBOR_USERNAME=" + fakeharbor.Username,
+		"HARBOR_PASSWORD=" + fakeharbor.Password,
+	}
+
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+	}{
+		{"prune on an empty root", nil, []string{"-action", "prune", "-keep-last-full", "1"}},
+		{"invalid action", nil, []string{"-action", "nope"}},
+		{"ping", harborEnv, []string{"-action", "ping"}},
+		{"full backup", harborEnv, []string{"-action", "full_backup"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "-backup-root", t.TempDir())
+			code, output := runMain(t, tt.env, args...)
+			if code != 0 || strings.Contains(output, "Stopped by signal") {
+				t.Errorf("exit code %d, want 0; output:\n%s", code, output)
+			}
+		})
+	}
+}
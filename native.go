@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// nativePuller 不依赖 docker 守护进程，直接从 Harbor 的 /v2/ 接口拉取清单和 blob
+// 输出的 tar 同时包含 manifest.json(docker load) 和 OCI 布局(index.json、blobs/)
+type nativePuller struct {
+	registry *registryClient
+}
+
+func (p *nativePuller) Save(ctx context.Context, uri, filePath string) error {
+	ref, err := parseArtifactURI(uri)
+	if err != nil {
+		return err
+	}
+
+	manifestBytes, manifestDesc, manifest, err := p.registry.fetchImageManifest(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("failed to download artifact %s: %w", uri, err)
+	}
+
+	// 先写入临时文件，成功后再重命名，避免留下不完整的 tar
+	tmpPath := filePath + ".partial"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %v", tmpPath, err)
+	}
+
+	err = p.writeArchive(ctx, f, ref, uri, manifestBytes, manifestDesc, manifest)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save artifact %s: %w", uri, err)
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// writeArchive 按 docker save 的格式写出镜像
+func (p *nativePuller) writeArchive(ctx context.Context, w io.Writer, ref artifactRef, uri string, manifestBytes []byte, manifestDesc descriptor, manifest *imageManifest) error {
+	tw := tar.NewWriter(w)
+
+	if err := writeTarFile(tw, "oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, blobPath(manifestDesc.Digest), manifestBytes); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	blobs := append([]descriptor{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		if written[blob.Digest] {
+			continue
+		}
+		body, err := p.registry.fetchBlob(ctx, ref.Host, ref.Repository, blob.Digest)
+		if err != nil {
+			return err
+		}
+		err = writeTarBlob(tw, blob, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+		written[blob.Digest] = true
+	}
+
+	manifestDesc.Annotations = map[string]string{"io.containerd.image.name": uri}
+	index := imageIndex{SchemaVersion: 2, MediaType: mediaTypeOCIIndex, Manifests: []descriptor{manifestDesc}}
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "index.json", indexBytes); err != nil {
+		return err
+	}
+
+	// manifest.json 供 docker load 使用，层文件为原始的压缩 blob
+	type dockerArchiveManifest struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	entry := dockerArchiveManifest{Config: blobPath(manifest.Config.Digest), Layers: []string{}}
+	for _, layer := range manifest.Layers {
+		entry.Layers = append(entry.Layers, blobPath(layer.Digest))
+	}
+	dockerManifestBytes, err := json.Marshal([]dockerArchiveManifest{entry})
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "manifest.json", dockerManifestBytes); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// blobPath 返回 blob 在 OCI 布局中的路径，如 blobs/sha256/<hex>
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// writeTarFile 向 tar 写入一个小文件
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeTarBlob 将 blob 流式写入 tar，同时校验大小和摘要
+func writeTarBlob(tw *tar.Writer, blob descriptor, r io.Reader) error {
+	hdr := &tar.Header{Name: blobPath(blob.Digest), Mode: 0644, Size: blob.Size, ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	return copyVerified(tw, r, blob)
+}
+
+// copyVerified 拷贝 blob 内容并校验大小和 sha256 摘要
+func copyVerified(w io.Writer, r io.Reader, blob descriptor) error {
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hasher), io.LimitReader(r, blob.Size))
+	if err != nil {
+		return fmt.Errorf("error copying blob %s: %w", blob.Digest, err)
+	}
+	if n != blob.Size {
+		return fmt.Errorf("short read for blob %s: got %d of %d bytes", blob.Digest, n, blob.Size)
+	}
+	// 多出来的数据说明描述符和实际内容不一致
+	if extra, _ := io.Copy(ioutil.Discard, io.LimitReader(r, 1)); extra > 0 {
+		return fmt.Errorf("blob %s is larger than its descriptor size %d", blob.Digest, blob.Size)
+	}
+	if got := "sha256:" + hex.EncodeToString(hasher.Sum(nil)); got != blob.Digest {
+		return fmt.Errorf("digest mismatch for blob %s: got %s", blob.Digest, got)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ociLayoutWriter 把一次备份的所有制品写入同一个 OCI 镜像布局目录
+// (oci-layout、index.json、blobs/sha256/...)，相同的 blob 只保存一份
+type ociLayoutWriter struct {
+	dir      string
+	registry *registryClient
+
+	mu        sync.Mutex
+	manifests []descriptor
+	blobLocks map[string]*sync.Mutex // 同一个 blob 同时只允许一个 goroutine 下载
+}
+
+// newOCILayoutWriter 在 dir 下初始化 OCI 布局
+func newOCILayoutWriter(dir string, registry *registryClient) (*ociLayoutWriter, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blobs directory: %v", err)
+	}
+	err := ioutil.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write oci-layout: %v", err)
+	}
+
+	// 续传时保留已经写入 index.json 的清单
+	var manifests []descriptor
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		refs, err := readOCILayoutIndex(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range refs {
+			manifests = append(manifests, desc)
+		}
+	}
+
+	return &ociLayoutWriter{
+		dir:       dir,
+		registry:  registry,
+		manifests: manifests,
+		blobLocks: make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// Add 下载一个制品的清单、配置和层，并登记到 index.json，返回清单的描述符
+func (w *ociLayoutWriter) Add(ctx context.Context, uri string) (descriptor, error) {
+	ref, err := parseArtifactURI(uri)
+	if err != nil {
+		return descriptor{}, err
+	}
+
+	manifestBytes, manifestDesc, manifest, err := w.registry.fetchImageManifest(ctx, ref)
+	if err != nil {
+		return descriptor{}, fmt.Errorf("failed to download artifact %s: %w", uri, err)
+	}
+
+	blobs := append([]descriptor{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		if err := w.writeBlob(ctx, ref, blob); err != nil {
+			return descriptor{}, fmt.Errorf("failed to save artifact %s: %w", uri, err)
+		}
+	}
+
+	// 清单最后写入，保证被引用的 blob 都已经存在
+	err = w.withBlobLock(manifestDesc.Digest, func(path string) error {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		return writeFileAtomic(path, manifestBytes)
+	})
+	if err != nil {
+		return descriptor{}, fmt.Errorf("failed to save manifest of %s: %w", uri, err)
+	}
+
+	manifestDesc.Annotations = map[string]string{
+		"io.containerd.image.name":          uri,
+		"org.opencontainers.image.ref.name": uri,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// 续传时同一个 URI 可能已经在 index.json 中，替换旧条目
+	for i, desc := range w.manifests {
+		if desc.Annotations["org.opencontainers.image.ref.name"] == uri {
+			w.manifests[i] = manifestDesc
+			return manifestDesc, nil
+		}
+	}
+	w.manifests = append(w.manifests, manifestDesc)
+	return manifestDesc, nil
+}
+
+// writeBlob 下载 blob，已存在且大小一致时跳过
+func (w *ociLayoutWriter) writeBlob(ctx context.Context, ref artifactRef, blob descriptor) error {
+	return w.withBlobLock(blob.Digest, func(path string) error {
+		if info, err := os.Stat(path); err == nil && info.Size() == blob.Size {
+			return nil
+		}
+
+		body, err := w.registry.fetchBlob(ctx, ref.Host, ref.Repository, blob.Digest)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		tmpPath := path + ".partial"
+		f, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		err = copyVerified(f, body, blob)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		return os.Rename(tmpPath, path)
+	})
+}
+
+// withBlobLock 在持有 digest 对应锁的情况下执行 fn
+func (w *ociLayoutWriter) withBlobLock(digest string, fn func(path string) error) error {
+	w.mu.Lock()
+	lock, ok := w.blobLocks[digest]
+	if !ok {
+		lock = &sync.Mutex{}
+		w.blobLocks[digest] = lock
+	}
+	w.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	return fn(filepath.Join(w.dir, filepath.FromSlash(blobPath(digest))))
+}
+
+// Close 写出 index.json，条目按 URI 排序以保证输出稳定
+// 备份过程中也会调用它作为检查点
+func (w *ociLayoutWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sort.Slice(w.manifests, func(i, j int) bool {
+		return w.manifests[i].Annotations["io.containerd.image.name"] < w.manifests[j].Annotations["io.containerd.image.name"]
+	})
+	index := imageIndex{SchemaVersion: 2, MediaType: mediaTypeOCIIndex, Manifests: append([]descriptor{}, w.manifests...)}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(w.dir, "index.json"), data)
+}
+
+// writeFileAtomic 先写临时文件再重命名
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".partial"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -1,9 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+
+	"harbor_api_mario/harbor"
+)
 
 // Print projects in a formatted way
-func printProjects(projects []Project) {
+func printProjects(projects []harbor.Project) {
 	fmt.Println("Projects:")
 	for _, project := range projects {
 		fmt.Printf("  - Name: %s\n", project.Name)
@@ -16,7 +20,7 @@ func printProjects(projects []Project) {
 }
 
 // Print repositories in a formatted way
-func printRepositories(repositories []Repository) {
+func printRepositories(repositories []harbor.Repository) {
 	fmt.Println("Repositories:")
 	for _, repository := range repositories {
 		fmt.Printf("  - Name: %s\n", repository.Name)
@@ -30,7 +34,7 @@ func printRepositories(repositories []Repository) {
 }
 
 // Print artifacts in a formatted way
-func printArtifacts(artifacts []Artifact) {
+func printArtifacts(artifacts []harbor.Artifact) {
 	fmt.Println("Artifacts:")
 	for _, artifact := range artifacts {
 		fmt.Printf("  - Digest: %s\n", artifact.Digest)
@@ -96,3 +100,14 @@ func printArtifactsWithTypes(artifactMap map[string][]string) {
 		}
 	}
 }
+
+// 打印Harbor统计信息
+func printHarborStatistics(stats *harbor.HarborStatistics) {
+	fmt.Println("Harbor Statistics:")
+	fmt.Printf("Private Project Count: %d\n", stats.PrivateProjectCount)
+	fmt.Printf("Private Repo Count: %d\n", stats.PrivateRepoCount)
+	fmt.Printf("Public Project Count: %d\n", stats.PublicProjectCount)
+	fmt.Printf("Public Repo Count: %d\n", stats.PublicRepoCount)
+	fmt.Printf("Total Project Count: %d\n", stats.TotalProjectCount)
+	fmt.Printf("Total Repo Count: %d\n", stats.TotalRepoCount)
+}
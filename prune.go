@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pruneOptions 清理旧备份的保留策略，满足任意一条策略的备份都会保留
+type pruneOptions struct {
+	Root         string
+	KeepLastFull int // 保留最近 N 个全量备份
+	KeepDaily    int // 最近 N 天每天保留最新的一个备份
+	KeepWeekly   int // 最近 N 周每周保留最新的一个备份
+	KeepMonthly  int // 最近 N 个月每月保留最新的一个备份
+	KeepDays     int // 保留最近 N 天内的全部备份
+	DryRun       bool
+}
+
+// validate 至少要指定一条保留策略，避免误删全部备份
+func (opts pruneOptions) validate() error {
+	values := []int{opts.KeepLastFull, opts.KeepDaily, opts.KeepWeekly, opts.KeepMonthly, opts.KeepDays}
+	total := 0
+	for _, value := range values {
+		if value < 0 {
+			return fmt.Errorf("retention values must not be negative")
+		}
+		total += value
+	}
+	if total == 0 {
+		return fmt.Errorf("no retention policy given, use at least one of " +
+			"--keep-last-full, --keep-daily, --keep-weekly, --keep-monthly, --keep-days")
+	}
+	return nil
+}
+
+// backupDirInfo 是备份根目录下的一个备份目录
+type backupDirInfo struct {
+	Name      string
+	Type      string
+	Time      time.Time // 目录名中的时间戳
+	Completed bool
+	Chain     []string // 恢复它需要的目录名，包含它自己
+	// ChainUnresolved 为 true 时不知道它依赖哪些备份(索引损坏、基准缺失等)
+	ChainUnresolved bool
+}
+
+// pruneBackups 按保留策略删除旧备份；被保留的差量/增量备份所依赖的备份链不会被删除
+func pruneBackups(opts pruneOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// 删除之前先读取备份链索引，索引损坏时不删除任何备份
+	index, err := readBackupIndex(opts.Root)
+	if err != nil {
+		return fmt.Errorf("cannot prune without a readable %s: %v", backupIndexFile, err)
+	}
+
+	backups, err := listBackupDirs(opts.Root)
+	if err != nil {
+		return err
+	}
+
+	// 下一次差量备份以 last_full_backup_path.txt 指向的全量备份为基准
+	lastFull := ""
+	if path, err := getLastBackupPath(opts.Root); err == nil {
+		lastFull = filepath.Base(path)
+	}
+
+	keep, remove := planPrune(backups, opts, time.Now(), lastFull)
+
+	for _, backup := range backups {
+		if reasons, ok := keep[backup.Name]; ok {
+			fmt.Printf("keep   %s (%s)\n", backup.Name, strings.Join(reasons, ", "))
+		}
+	}
+	for _, backup := range remove {
+		if opts.DryRun {
+			fmt.Printf("would remove %s\n", backup.Name)
+		} else {
+			fmt.Printf("remove %s\n", backup.Name)
+		}
+	}
+	fmt.Printf("Keeping %d backups, removing %d\n", len(keep), len(remove))
+	if opts.DryRun || len(remove) == 0 {
+		return nil
+	}
+
+	removed := make(map[string]bool, len(remove))
+	var failed []string
+	for _, backup := range remove {
+		if err := os.RemoveAll(filepath.Join(opts.Root, backup.Name)); err != nil {
+			fmt.Printf("failed to remove %s: %v\n", backup.Name, err)
+			failed = append(failed, backup.Name)
+			continue
+		}
+		removed[backup.Name] = true
+	}
+
+	// 从备份链索引中去掉已删除的备份，writeBackupIndex 先写临时文件再重命名
+	entries := []BackupIndexEntry{}
+	for _, entry := range index.Backups {
+		if !removed[entry.Name] {
+			entries = append(entries, entry)
+		}
+	}
+	index.Backups = entries
+	if err := writeBackupIndex(opts.Root, index); err != nil {
+		return fmt.Errorf("failed to write %s: %v", backupIndexFile, err)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove %d backups: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// listBackupDirs 列出根目录下的 full_、delta_、incr_ 备份目录，按时间从旧到新排序
+func listBackupDirs(root string) ([]backupDirInfo, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupDirInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		backupType := ""
+		for _, t := range []string{backupTypeFull, backupTypeDelta, backupTypeIncremental} {
+			if strings.HasPrefix(name, backupDirPrefix(t)) {
+				backupType = t
+			}
+		}
+		if backupType == "" {
+			continue
+		}
+		timestamp, err := time.ParseInLocation("2006-01-02_15-04-05.000000000", backupTimestamp(name), time.Local)
+		if err != nil {
+			fmt.Printf("Skipping %s: cannot parse timestamp: %v\n", name, err)
+			continue
+		}
+
+		dir := filepath.Join(root, name)
+		backup := backupDirInfo{Name: name, Type: backupType, Time: timestamp, Completed: true, Chain: []string{name}}
+		// 没有清单的旧备份视为已完成
+		if manifest, err := readBackupManifest(dir); err == nil {
+			backup.Completed = manifest.Status != backupStatusInProgress && manifest.Status != backupStatusInterrupted
+		}
+		if chain, err := resolveBackupChain(dir); err == nil {
+			backup.Chain = chainNames(chain)
+		} else {
+			backup.ChainUnresolved = true
+			fmt.Printf("Warning: cannot resolve backup chain of %s, backups older than it are kept while it is kept: %v\n", name, err)
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups, nil
+}
+
+// planPrune 计算要保留和删除的备份，返回保留的目录名及原因
+func planPrune(backups []backupDirInfo, opts pruneOptions, now time.Time, lastFull string) (map[string][]string, []backupDirInfo) {
+	keep := make(map[string][]string)
+	mark := func(name, reason string) {
+		keep[name] = append(keep[name], reason)
+	}
+
+	// 从新到旧只统计已完成的备份
+	var completed []backupDirInfo
+	for i := len(backups) - 1; i >= 0; i-- {
+		if backups[i].Completed {
+			completed = append(completed, backups[i])
+		}
+	}
+
+	// 下一次增量备份以最新完成的备份为基准；比它更新的未完成备份可能仍在运行或等待续传
+	if len(completed) > 0 {
+		mark(completed[0].Name, "latest")
+	}
+	for _, backup := range backups {
+		if !backup.Completed && (len(completed) == 0 || backup.Time.After(completed[0].Time)) {
+			mark(backup.Name, "in progress")
+		}
+		if backup.Name == lastFull {
+			mark(backup.Name, "last full backup")
+		}
+	}
+
+	fulls := 0
+	for _, backup := range completed {
+		if backup.Type == backupTypeFull && fulls < opts.KeepLastFull {
+			fulls++
+			mark(backup.Name, "last full")
+		}
+	}
+
+	keepPeriods := func(limit int, reason string, period func(time.Time) string) {
+		seen := make(map[string]bool)
+		for _, backup := range completed {
+			key := period(backup.Time)
+			if seen[key] {
+				continue
+			}
+			if len(seen) >= limit {
+				break
+			}
+			seen[key] = true
+			mark(backup.Name, reason)
+		}
+	}
+	keepPeriods(opts.KeepDaily, "daily", func(t time.Time) string { return t.Format("2006-01-02") })
+	keepPeriods(opts.KeepWeekly, "weekly", func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%02d", year, week)
+	})
+	keepPeriods(opts.KeepMonthly, "monthly", func(t time.Time) string { return t.Format("2006-01") })
+
+	if opts.KeepDays > 0 {
+		cutoff := now.AddDate(0, 0, -opts.KeepDays)
+		for _, backup := range backups {
+			if backup.Time.After(cutoff) {
+				mark(backup.Name, fmt.Sprintf("within %d days", opts.KeepDays))
+			}
+		}
+	}
+
+	// 被保留的备份依赖的全量/差量/增量备份也必须保留
+	for _, backup := range backups {
+		if _, ok := keep[backup.Name]; !ok {
+			continue
+		}
+		for _, name := range backup.Chain {
+			if name != backup.Name {
+				mark(name, "base of "+backup.Name)
+			}
+		}
+	}
+
+	// 备份链无法解析时不知道它依赖哪些备份，保留比它旧的全部备份
+	for _, backup := range backups {
+		if _, ok := keep[backup.Name]; !ok || !backup.ChainUnresolved {
+			continue
+		}
+		for _, older := range backups {
+			if older.Time.Before(backup.Time) {
+				mark(older.Name, "possible base of "+backup.Name+", backup chain unresolved")
+			}
+		}
+	}
+
+	var remove []backupDirInfo
+	for _, backup := range backups {
+		if _, ok := keep[backup.Name]; !ok {
+			remove = append(remove, backup)
+		}
+	}
+	return keep, remove
+}
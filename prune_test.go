@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTestBackup 在 root 中创建一个已完成的备份目录，base 为差量/增量备份的基准目录名
+func writeTestBackup(t *testing.T, root, name, base string) {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := newBackupManifest(backupTypeFromDirName(name), backupFormatTar, "harbor.example.com", nil)
+	manifest.BaseBackup = base
+	manifest.Status = backupStatusCompleted
+	if err := writeBackupManifest(dir, manifest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backupTypeFromDirName 根据目录名前缀返回备份类型
+func backupTypeFromDirName(name string) string {
+	for _, t := range []string{backupTypeFull, backupTypeDelta, backupTypeIncremental} {
+		if strings.HasPrefix(name, backupDirPrefix(t)) {
+			return t
+		}
+	}
+	return ""
+}
+
+// remainingBackups 返回 root 中剩下的目录名，按时间从旧到新排序
+func remainingBackups(t *testing.T, root string) []string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return backupTimestamp(names[i]) < backupTimestamp(names[j]) })
+	return names
+}
+
+const (
+	pruneOldFull  = "full_2024-01-01_00-00-00.000000000"
+	pruneBaseFull = "full_2024-01-02_00-00-00.000000000"
+	pruneLastFull = "full_2024-01-03_00-00-00.000000000"
+	pruneNewDelta = "delta_2024-01-04_00-00-00.000000000"
+)
+
+func TestPruneKeepsBaseOfDeltaWithoutIndex(t *testing.T) {
+	// 差量备份以较早的全量备份为基准，之后又做了一次全量备份，但没有 backup_index.json
+	root := t.TempDir()
+	writeTestBackup(t, root, pruneOldFull, "")
+	writeTestBackup(t, root, pruneBaseFull, "")
+	writeTestBackup(t, root, pruneLastFull, "")
+	writeTestBackup(t, root, pruneNewDelta, pruneBaseFull)
+
+	if err := pruneBackups(pruneOptions{Root: root, KeepLastFull: 1}); err != nil {
+		t.Fatalf("pruneBackups: %v", err)
+	}
+	want := []string{pruneBaseFull, pruneLastFull, pruneNewDelta}
+	if got := remainingBackups(t, root); !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining backups = %v, want %v", got, want)
+	}
+}
+
+func TestPruneKeepsOlderBackupsWhenChainUnresolved(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, root string)
+	}{
+		{"base backup missing", func(t *testing.T, root string) {
+			writeTestBackup(t, root, pruneNewDelta, "full_2023-12-31_00-00-00.000000000")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestBackup(t, root, pruneOldFull, "")
+			writeTestBackup(t, root, pruneBaseFull, "")
+			writeTestBackup(t, root, pruneLastFull, "")
+			tt.setup(t, root)
+
+			if err := pruneBackups(pruneOptions{Root: root, KeepLastFull: 1}); err != nil {
+				t.Fatalf("pruneBackups: %v", err)
+			}
+			want := []string{pruneOldFull, pruneBaseFull, pruneLastFull, pruneNewDelta}
+			if got := remainingBackups(t, root); !reflect.DeepEqual(got, want) {
+				t.Errorf("remaining backups = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPruneWithCorruptIndexDeletesNothing(t *testing.T) {
+	root := t.TempDir()
+	writeTestBackup(t, root, pruneOldFull, "")
+	writeTestBackup(t, root, pruneBaseFull, "")
+	writeTestBackup(t, root, pruneLastFull, "")
+	if err := ioutil.WriteFile(filepath.Join(root, backupIndexFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneBackups(pruneOptions{Root: root, KeepLastFull: 1}); err == nil {
+		t.Fatal("pruneBackups succeeded with a corrupt index, want an error")
+	}
+	want := []string{pruneOldFull, pruneBaseFull, pruneLastFull}
+	if got := remainingBackups(t, root); !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining backups = %v, want %v", got, want)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(root, backupIndexFile)); err != nil || string(data) != "{" {
+		t.Errorf("%s was rewritten: %q, %v", backupIndexFile, data, err)
+	}
+}
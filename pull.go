@@ -1,19 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"harbor_api_mario/harbor"
 )
 
-// 用于下载所有制品
-func downloadArtifacts(baseURL, auth string) error {
+// 用于下载所有制品到容器运行时的本地镜像存储
+func downloadArtifacts(ctx context.Context, client *harbor.Client, runtime containerRuntime) error {
 	// 调用 fetchAllArtifactsWithTypes 获取 URI 列表
-	artifactURIs, err := fetchAllArtifactsWithTypes(baseURL, auth)
+	artifactURIs, err := fetchAllArtifactsWithTypes(ctx, client)
 	if err != nil {
 		fmt.Printf("Error fetching artifacts: %v\n", err)
 		return err
@@ -27,11 +29,13 @@ func downloadArtifacts(baseURL, auth string) error {
 	}
 
 	for _, uri := range nonUnknownArchURIs {
+		if err := checkInterrupted(ctx); err != nil {
+			return err
+		}
 		fmt.Printf("Downloading artifact: %s\n", uri)
-		cmd := exec.Command("docker", "pull", uri)
-		output, err := cmd.CombinedOutput()
+		_, err := retry(ctx, uri, func() error { return runtime.Pull(ctx, uri) })
 		if err != nil {
-			return fmt.Errorf("failed to download artifact %s: %v\nOutput: %s", uri, err, string(output))
+			return err
 		}
 		fmt.Printf("Successfully downloaded artifact: %s\n", uri)
 	}
@@ -39,13 +43,13 @@ func downloadArtifacts(baseURL, auth string) error {
 	return nil
 }
 
-// 用于下载并保存所有制品的函数
-func downloadAndSaveArtifacts(baseURL, auth string) error {
+// 用于下载并保存所有制品的函数，保存到备份根目录下以时间戳命名的目录
+func downloadAndSaveArtifacts(ctx context.Context, client *harbor.Client, puller artifactPuller, root string) error {
 	startTime := time.Now()
 	fmt.Printf("Start time: %s\n", startTime.Format("2006-01-02 15:04:05.000000000"))
 
 	// 调用 fetchAllArtifactsWithTypes 获取 URI 列表
-	artifactURIs, err := fetchAllArtifactsWithTypes(baseURL, auth)
+	artifactURIs, err := fetchAllArtifactsWithTypes(ctx, client)
 	if err != nil {
 		fmt.Printf("Error fetching artifacts: %v\n", err)
 		return err
@@ -60,7 +64,7 @@ func downloadAndSaveArtifacts(baseURL, auth string) error {
 
 	// 创建一个以时间戳命名的保存目录
 	timestamp := time.Now().Format("2006-01-02_15-04-05.000000000")
-	savePath := filepath.Join(".", "artifacts", timestamp)
+	savePath := filepath.Join(root, timestamp)
 	err = os.MkdirAll(savePath, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create save directory: %v", err)
@@ -89,24 +93,19 @@ func downloadAndSaveArtifacts(baseURL, auth string) error {
 			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
-			fmt.Printf("Downloading artifact: %s\n", uri)
-			cmd := exec.Command("docker", "pull", uri)
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("failed to download artifact %s: %v\nOutput: %s", uri, err, string(output))
+			// 收到停止信号后不再开始新的制品
+			if stopping(ctx) {
 				return
 			}
-			fmt.Printf("Successfully downloaded artifact: %s\n", uri)
 
 			// Save the artifact to a file
 			fileName := fmt.Sprintf("%s.tar", uriToFileName(uri))
 			filePath := filepath.Join(savePath, fileName)
 
-			fmt.Printf("Saving artifact to: %s\n", filePath)
-			saveCmd := exec.Command("docker", "save", "-o", filePath, uri)
-			saveOutput, saveErr := saveCmd.CombinedOutput()
-			if saveErr != nil {
-				fmt.Printf("failed to save artifact %s: %v\nOutput: %s", uri, saveErr, string(saveOutput))
+			fmt.Printf("Downloading artifact: %s\n", uri)
+			_, err := saveWithRetry(ctx, puller, uri, func() error { return puller.Save(ctx, uri, filePath) })
+			if err != nil {
+				fmt.Printf("%v\n", err)
 				return
 			}
 			fmt.Printf("Successfully saved artifact: %s\n", filePath)
@@ -128,6 +127,9 @@ func downloadAndSaveArtifacts(baseURL, auth string) error {
 	fmt.Printf("End time: %s\n", endTime.Format("2006-01-02 15:04:05.000000000"))
 	fmt.Printf("Duration: %s\n", endTime.Sub(startTime))
 
+	if stopping(ctx) {
+		return fmt.Errorf("saving to %s was %v", savePath, errInterrupted)
+	}
 	return nil
 }
 
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"harbor_api_mario/harbor"
+)
+
+// artifactPuller 负责把单个制品 URI 拉取并保存为 tar 文件
+type artifactPuller interface {
+	// Save 在 ctx 取消时中止，并删除未写完的文件
+	Save(ctx context.Context, uri, filePath string) error
+}
+
+// newArtifactPuller 根据 -puller 参数创建对应的实现
+func newArtifactPuller(name string, client *harbor.Client) (artifactPuller, error) {
+	switch name {
+	case "", "native":
+		registry, err := newRegistryClient(client)
+		if err != nil {
+			return nil, err
+		}
+		return &nativePuller{registry: registry}, nil
+	case runtimeDocker, runtimePodman, runtimeNerdctl, runtimeSkopeo:
+		if downloadLimiter != nil {
+			// 拉取由容器运行时完成，这里无法限制它的下载速度
+			fmt.Printf("Warning: --max-bandwidth does not apply to the %s puller, use it with -puller native\n", name)
+		}
+		return newContainerRuntime(name, keepImages)
+	default:
+		return nil, fmt.Errorf("unknown puller: %s (supported: native, docker, podman, nerdctl, skopeo)", name)
+	}
+}
+
+// saveWithRetry 保存单个制品，返回尝试次数和最后一次的错误。
+// nativePuller 的每个清单和 blob 请求已经按 defaultRetryPolicy 重试，整个制品不再重试，
+// 避免两层重试让请求次数相乘；容器运行时的命令失败时整个制品重新保存
+func saveWithRetry(ctx context.Context, puller artifactPuller, uri string, save func() error) (int, error) {
+	if _, ok := puller.(*nativePuller); ok {
+		return 1, save()
+	}
+	return retry(ctx, uri, save)
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// 镜像清单相关的媒体类型
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// descriptor 对应 OCI 描述符，用于引用清单、配置和层
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// imageManifest 同时兼容镜像清单和清单列表(index)
+type imageManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+	Manifests     []descriptor `json:"manifests,omitempty"`
+}
+
+// imageIndex 用于写出 OCI 布局中的 index.json
+type imageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+// artifactRef 是解析后的制品 URI，形如 host/project/repo@sha256:xxx
+type artifactRef struct {
+	Host       string
+	Repository string
+	Digest     string
+}
+
+func (r artifactRef) String() string {
+	return fmt.Sprintf("%s/%s@%s", r.Host, r.Repository, r.Digest)
+}
+
+// parseArtifactURI 解析 fetchAllArtifactsWithTypes 生成的 URI
+func parseArtifactURI(uri string) (artifactRef, error) {
+	name, digest, found := strings.Cut(uri, "@")
+	if !found || digest == "" {
+		return artifactRef{}, fmt.Errorf("invalid artifact URI (missing digest): %s", uri)
+	}
+	host, repo, found := strings.Cut(name, "/")
+	if !found || host == "" || repo == "" {
+		return artifactRef{}, fmt.Errorf("invalid artifact URI (missing repository): %s", uri)
+	}
+	return artifactRef{Host: host, Repository: repo, Digest: digest}, nil
+}
+
+// registryClient 直接访问 Harbor 的 /v2/ 接口(OCI Distribution)
+// 认证复用 Harbor API 的凭据，遇到 Bearer 质询时用同一个 Authorization 头向 Harbor 的 token 服务换取 token
+type registryClient struct {
+	scheme string
+	auth   string // Harbor API 的 Authorization 头，匿名访问时为空
+	client *http.Client
+
+	mu         sync.Mutex
+	challenges map[string]authChallenge // host -> 质询信息
+	tokens     map[string]registryToken // host + scope -> token
+}
+
+type authChallenge struct {
+	Scheme  string
+	Realm   string
+	Service string
+}
+
+type registryToken struct {
+	Value   string
+	Expires time.Time
+}
+
+// newRegistryClient 创建与 Harbor API 客户端使用同一个地址协议和凭据的 registry 客户端
+func newRegistryClient(api *harbor.Client) (*registryClient, error) {
+	u, err := url.Parse(api.BaseURL())
+	if err != nil {
+		return nil, fmt.Errorf("invalid baseURL: %v", err)
+	}
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return &registryClient{
+		scheme:     scheme,
+		auth:       api.Authorization(),
+		client:     transferClient,
+		challenges: make(map[string]authChallenge),
+		tokens:     make(map[string]registryToken),
+	}, nil
+}
+
+// fetchManifest 获取指定引用的清单原文，并校验摘要
+func (r *registryClient) fetchManifest(ctx context.Context, host, repo, reference string) ([]byte, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join([]string{
+		mediaTypeOCIManifest, mediaTypeDockerManifest, mediaTypeOCIIndex, mediaTypeDockerManifestList,
+	}, ", "))
+
+	resp, err := r.do(ctx, registryRequest{Method: "GET", Host: host, Repo: repo, Path: "/manifests/" + reference, Header: header, Actions: "pull"})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch manifest %s/%s@%s: %w", host, repo, reference, harbor.NewAPIError(resp))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if strings.HasPrefix(reference, "sha256:") && sha256Digest(body) != reference {
+		return nil, "", fmt.Errorf("manifest digest mismatch for %s/%s@%s", host, repo, reference)
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return body, mediaType, nil
+}
+
+// fetchImageManifest 获取镜像清单；如果是清单列表则按当前平台选取一个子清单
+func (r *registryClient) fetchImageManifest(ctx context.Context, ref artifactRef) ([]byte, descriptor, *imageManifest, error) {
+	reference := ref.Digest
+	for depth := 0; depth < 2; depth++ {
+		body, mediaType, err := r.fetchManifest(ctx, ref.Host, ref.Repository, reference)
+		if err != nil {
+			return nil, descriptor{}, nil, err
+		}
+
+		var m imageManifest
+		if err := json.Unmarshal(body, &m); err != nil {
+			return nil, descriptor{}, nil, fmt.Errorf("error parsing manifest of %s: %w", ref, err)
+		}
+		if m.MediaType != "" {
+			mediaType = m.MediaType
+		}
+
+		switch mediaType {
+		case mediaTypeDockerManifest, mediaTypeOCIManifest:
+			desc := descriptor{MediaType: mediaType, Digest: sha256Digest(body), Size: int64(len(body))}
+			return body, desc, &m, nil
+		case mediaTypeDockerManifestList, mediaTypeOCIIndex:
+			child, err := selectPlatformManifest(m.Manifests)
+			if err != nil {
+				return nil, descriptor{}, nil, fmt.Errorf("%s: %w", ref, err)
+			}
+			reference = child.Digest
+		default:
+			return nil, descriptor{}, nil, fmt.Errorf("unsupported manifest media type %q for %s", mediaType, ref)
+		}
+	}
+	return nil, descriptor{}, nil, fmt.Errorf("nested manifest lists are not supported: %s", ref)
+}
+
+// selectPlatformManifest 与 docker pull 行为一致，优先选择 linux/当前架构
+func selectPlatformManifest(manifests []descriptor) (descriptor, error) {
+	for _, m := range manifests {
+		if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH {
+			return m, nil
+		}
+	}
+	for _, m := range manifests {
+		if m.Platform != nil && m.Platform.OS != "unknown" && m.Platform.Architecture != "unknown" {
+			return m, nil
+		}
+	}
+	return descriptor{}, fmt.Errorf("no usable platform in manifest list")
+}
+
+// fetchBlob 获取 blob 内容，调用方负责关闭
+func (r *registryClient) fetchBlob(ctx context.Context, host, repo, digest string) (io.ReadCloser, error) {
+	resp, err := r.do(ctx, registryRequest{Method: "GET", Host: host, Repo: repo, Path: "/blobs/" + digest, Actions: "pull"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch blob %s/%s@%s: %w", host, repo, digest, harbor.NewAPIError(resp))
+	}
+	return throttleDownload(ctx, resp.Body), nil
+}
+
+// registryRequest 描述一次 /v2/ 请求
+type registryRequest struct {
+	Method  string
+	Host    string
+	Repo    string
+	Path    string // 相对 /v2/<repo> 的路径
+	URL     string // 完整地址(如上传返回的 Location)，非空时忽略 Path
+	Header  http.Header
+	Actions string // pull 或 pull,push
+
+	// Body 每次发送前重新打开，以便认证失败后重试
+	Body func() (io.Reader, error)
+	Size int64
+}
+
+// do 发送 /v2/ 请求，自动处理认证；token 过期时重试一次
+func (r *registryClient) do(ctx context.Context, rr registryRequest) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:%s", rr.Repo, rr.Actions)
+	endpoint := rr.URL
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("%s://%s/v2/%s%s", r.scheme, rr.Host, rr.Repo, rr.Path)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		authHeader, err := r.authorization(ctx, rr.Host, scope, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var body io.Reader
+		if rr.Body != nil {
+			body, err = rr.Body()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, rr.Method, endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+		if rr.Body != nil {
+			req.ContentLength = rr.Size
+		}
+		for k, v := range rr.Header {
+			req.Header[k] = v
+		}
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+
+		resp, err := r.send(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+	return nil, fmt.Errorf("unauthorized: %s %s", rr.Method, endpoint)
+}
+
+// send 发送单个请求；没有请求体的 GET/HEAD 遇到临时错误时按默认策略重试
+func (r *registryClient) send(req *http.Request) (*http.Response, error) {
+	if req.Body != nil || (req.Method != "GET" && req.Method != "HEAD") {
+		return r.client.Do(req)
+	}
+	return defaultRetryPolicy.Do(r.client, func() (*http.Request, error) {
+		return req.Clone(req.Context()), nil
+	})
+}
+
+// authorization 返回访问 scope 所需的 Authorization 头
+func (r *registryClient) authorization(ctx context.Context, host, scope string, refresh bool) (string, error) {
+	challenge, err := r.challenge(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(challenge.Scheme) {
+	case "":
+		return "", nil
+	case "basic":
+		return r.auth, nil
+	case "bearer":
+		token, err := r.bearerToken(ctx, host, scope, challenge, refresh)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("unsupported registry auth scheme: %s", challenge.Scheme)
+	}
+}
+
+// challenge 访问 /v2/ 获取并缓存认证质询
+func (r *registryClient) challenge(ctx context.Context, host string) (authChallenge, error) {
+	r.mu.Lock()
+	c, ok := r.challenges[host]
+	r.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s://%s/v2/", r.scheme, host), nil)
+	if err != nil {
+		return authChallenge{}, err
+	}
+	resp, err := r.send(req)
+	if err != nil {
+		return authChallenge{}, fmt.Errorf("error pinging registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		c = authChallenge{}
+	case http.StatusUnauthorized:
+		c = parseAuthChallenge(resp.Header.Get("WWW-Authenticate"))
+	default:
+		return authChallenge{}, fmt.Errorf("failed to ping registry: %w", harbor.NewAPIError(resp))
+	}
+
+	r.mu.Lock()
+	r.challenges[host] = c
+	r.mu.Unlock()
+	return c, nil
+}
+
+// parseAuthChallenge 解析 WWW-Authenticate: Bearer realm="...",service="..."
+func parseAuthChallenge(value string) authChallenge {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(value), " ")
+	c := authChallenge{Scheme: scheme}
+	for _, part := range strings.Split(params, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		val = strings.Trim(val, `"`)
+		switch strings.ToLower(key) {
+		case "realm":
+			c.Realm = val
+		case "service":
+			c.Service = val
+		}
+	}
+	return c
+}
+
+// bearerToken 用 Harbor 的凭据(Basic 或 Bearer)向 token 服务换取 scope 对应的 token
+func (r *registryClient) bearerToken(ctx context.Context, host, scope string, challenge authChallenge, refresh bool) (string, error) {
+	key := host + " " + scope
+	r.mu.Lock()
+	token, ok := r.tokens[key]
+	r.mu.Unlock()
+	if ok && !refresh && time.Until(token.Expires) > 30*time.Second {
+		return token.Value, nil
+	}
+
+	params := url.Values{}
+	if challenge.Service != "" {
+		params.Set("service", challenge.Service)
+	}
+	params.Set("scope", scope)
+	req, err := http.NewRequestWithContext(ctx, "GET", challenge.Realm+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.auth != "" {
+		req.Header.Set("Authorization", r.auth)
+	}
+
+	resp, err := r.send(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token: %w", harbor.NewAPIError(resp))
+	}
+
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("error parsing registry token response: %v", err)
+	}
+	if tr.Token == "" {
+		tr.Token = tr.AccessToken
+	}
+	if tr.ExpiresIn <= 0 {
+		tr.ExpiresIn = 60
+	}
+
+	token = registryToken{Value: tr.Token, Expires: time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)}
+	r.mu.Lock()
+	r.tokens[key] = token
+	r.mu.Unlock()
+	return token.Value, nil
+}
+
+// sha256Digest 计算内容的 sha256 摘要，格式为 sha256:<hex>
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
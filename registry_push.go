@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"harbor_api_mario/harbor"
+)
+
+// blobExists 检查目标仓库中是否已存在 blob
+func (r *registryClient) blobExists(ctx context.Context, host, repo, digest string) (bool, error) {
+	resp, err := r.do(ctx, registryRequest{Method: "HEAD", Host: host, Repo: repo, Path: "/blobs/" + digest, Actions: "pull,push"})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check blob %s/%s@%s: %w", host, repo, digest, harbor.NewAPIError(resp))
+	}
+}
+
+// uploadBlob 以单次上传(monolithic upload)的方式推送 blob
+// open 每次调用都要返回从头开始的内容
+func (r *registryClient) uploadBlob(ctx context.Context, host, repo string, blob descriptor, open func() (io.Reader, error)) error {
+	exists, err := r.blobExists(ctx, host, repo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	resp, err := r.do(ctx, registryRequest{Method: "POST", Host: host, Repo: repo, Path: "/blobs/uploads/", Actions: "pull,push"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		defer resp.Body.Close()
+		return fmt.Errorf("failed to start blob upload %s/%s@%s: %w", host, repo, blob.Digest, harbor.NewAPIError(resp))
+	}
+	resp.Body.Close()
+
+	// Location 可能是相对地址
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %v", err)
+	}
+	location = resp.Request.URL.ResolveReference(location)
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err = r.do(ctx, registryRequest{
+		Method: "PUT", Host: host, Repo: repo, URL: location.String(), Header: header, Actions: "pull,push",
+		Body: open, Size: blob.Size,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload blob %s/%s@%s: %w", host, repo, blob.Digest, harbor.NewAPIError(resp))
+	}
+	return nil
+}
+
+// putManifest 推送清单，reference 可以是 tag 或 digest
+func (r *registryClient) putManifest(ctx context.Context, host, repo, reference, mediaType string, manifest []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	resp, err := r.do(ctx, registryRequest{
+		Method: "PUT", Host: host, Repo: repo, Path: "/manifests/" + reference, Header: header, Actions: "pull,push",
+		Body: func() (io.Reader, error) { return bytes.NewReader(manifest), nil }, Size: int64(len(manifest)),
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to push manifest %s/%s@%s: %w", host, repo, reference, harbor.NewAPIError(resp))
+	}
+	return nil
+}
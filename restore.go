@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// restoreOptions 恢复备份的选项
+type restoreOptions struct {
+	BackupDir    string
+	Target       *harbor.Client // 目标 Harbor 的客户端，dry-run 时不使用
+	Projects     []string       // 项目名通配符，为空表示全部
+	Repositories []string       // 仓库名(project/repo)通配符，为空表示全部
+	DryRun       bool
+}
+
+// restoreItem 是一个待恢复的制品及其在备份中的位置
+type restoreItem struct {
+	URI    string
+	Ref    artifactRef
+	Source string      // tar 文件路径或 OCI 布局目录
+	Layout *descriptor // OCI 布局中的清单；tar 格式时为 nil
+	Tags   []string    // 按 digest 推送之后再推送的 tag
+}
+
+// restoreBackup 把备份目录(全量，或差量/增量加上其依赖的备份链)推送回 Harbor
+func restoreBackup(ctx context.Context, opts restoreOptions) error {
+	startTime := time.Now()
+	fmt.Printf("Start time: %s\n", startTime.Format("2006-01-02 15:04:05.000000000"))
+
+	chain, err := resolveBackupChain(opts.BackupDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restore chain: %s\n", strings.Join(chain, " -> "))
+
+	// 备份目录的 all_uri_list.txt 记录了备份时刻的全部制品
+	uris, err := readURIsFromFile(filepath.Join(opts.BackupDir, "all_uri_list.txt"))
+	if err != nil {
+		return fmt.Errorf("failed to read URI list: %v", err)
+	}
+
+	items, missing, err := locateRestoreItems(chain, uris, opts)
+	if err != nil {
+		return err
+	}
+	indexes, err := attachRestoreTags(chain, items)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		printRestorePlan(items, indexes, missing)
+		return nil
+	}
+
+	registry, err := newRegistryClient(opts.Target)
+	if err != nil {
+		return err
+	}
+
+	// 先创建缺失的项目，仓库会在推送时自动创建
+	projects := make(map[string]bool)
+	for _, item := range items {
+		projects[projectOfRepository(item.Ref.Repository)] = true
+	}
+	for project := range projects {
+		if err := ensureProject(ctx, opts.Target, project); err != nil {
+			return err
+		}
+	}
+
+	var failed []string
+	restored := make(map[string]bool, len(items)) // 按原 digest 恢复的制品，key 为 project/repo@digest
+	var failedMutex sync.Mutex
+
+	// 使用带缓冲的 channel 来限制并发 goroutine 数量
+	concurrencyLimit := 5 // 并发数量限制
+	semaphore := make(chan struct{}, concurrencyLimit)
+	var wg sync.WaitGroup
+
+	for _, item := range items {
+		wg.Add(1)
+		go func(item restoreItem) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}        // 获取信号量
+			defer func() { <-semaphore }() // 释放信号量
+
+			// 收到停止信号后不再开始新的推送
+			if stopping(ctx) {
+				return
+			}
+
+			ref := artifactRef{Host: opts.Target.Host(), Repository: item.Ref.Repository, Digest: item.Ref.Digest}
+			fmt.Printf("Pushing artifact: %s\n", ref)
+			digest, err := pushRestoreItem(ctx, registry, ref, item)
+			if err != nil {
+				fmt.Printf("failed to restore artifact %s: %v\n", item.URI, err)
+				failedMutex.Lock()
+				failed = append(failed, item.URI)
+				failedMutex.Unlock()
+				return
+			}
+			if digest != item.Ref.Digest {
+				fmt.Printf("Note: %s was rebuilt from a docker save archive and restored as %s@%s\n", item.URI, ref.Repository, digest)
+			} else {
+				failedMutex.Lock()
+				restored[artifactKey(item.Ref.Repository, item.Ref.Digest)] = true
+				failedMutex.Unlock()
+			}
+			fmt.Printf("Successfully restored artifact: %s\n", ref)
+		}(item)
+	}
+
+	wg.Wait()
+	if stopping(ctx) {
+		return fmt.Errorf("restore %v, %d artifacts failed before stopping", errInterrupted, len(failed))
+	}
+
+	// 多架构镜像的子制品都推送之后再推送索引，tag 打在索引上
+	untagged := 0
+	for _, index := range indexes {
+		ref := artifactRef{Host: opts.Target.Host(), Repository: index.Repository, Digest: index.Digest}
+		if index.Source == "" {
+			fmt.Printf("WARNING: the index %s is not in the backup (saved before indexes were backed up, or by a container runtime puller); "+
+				"its platforms were restored by digest only and its tags %v were NOT restored\n", ref, index.Tags)
+			untagged++
+			continue
+		}
+		fmt.Printf("Pushing index: %s\n", ref)
+		if err := pushRestoreIndex(ctx, registry, ref.Host, index, restored); err != nil {
+			fmt.Printf("failed to restore index %s: %v\n", ref, err)
+			failed = append(failed, ref.String())
+			continue
+		}
+		fmt.Printf("Successfully restored index: %s\n", ref)
+	}
+
+	endTime := time.Now()
+	fmt.Printf("End time: %s\n", endTime.Format("2006-01-02 15:04:05.000000000"))
+	fmt.Printf("Duration: %s\n", endTime.Sub(startTime))
+	fmt.Printf("Restored: %d, failed: %d, missing from backup: %d\n", len(items)+len(indexes)-untagged-len(failed), len(failed), len(missing))
+	if untagged > 0 {
+		fmt.Printf("WARNING: %d multi-arch images were restored without their index and tags\n", untagged)
+	}
+
+	if len(failed) > 0 || len(missing) > 0 {
+		return fmt.Errorf("%d artifacts failed to restore, %d artifacts missing from backup", len(failed), len(missing))
+	}
+	return nil
+}
+
+// resolveBackupChain 返回恢复 dir 所需的备份目录(从旧到新)
+// 优先使用备份根目录中的 backup_index.json；没有索引时，增量备份沿清单中的 base_backup 逐级向前，
+// 差量备份依赖清单中的 base_backup，旧版没有清单的差量备份依赖它之前最近的一次全量备份
+func resolveBackupChain(dir string) ([]string, error) {
+	dir = filepath.Clean(dir)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	root, name := filepath.Dir(dir), filepath.Base(dir)
+	index, err := readBackupIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	if entry := index.find(name); entry != nil && len(entry.Chain) > 0 {
+		chain := make([]string, 0, len(entry.Chain))
+		for _, chainName := range entry.Chain {
+			chain = append(chain, filepath.Join(root, chainName))
+		}
+		return chain, nil
+	}
+
+	if strings.HasPrefix(name, "incr_") {
+		manifest, err := readBackupManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		if manifest.BaseBackup == "" {
+			return nil, fmt.Errorf("incremental backup %s has no base backup", dir)
+		}
+		chain, err := resolveBackupChain(filepath.Join(root, filepath.Base(manifest.BaseBackup)))
+		if err != nil {
+			return nil, err
+		}
+		return append(chain, dir), nil
+	}
+
+	if !strings.HasPrefix(name, "delta_") {
+		return []string{dir}, nil
+	}
+
+	// 差量备份的清单记录了它的全量基准，基准不一定是它之前最近的全量备份
+	manifest, err := readBackupManifest(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if manifest != nil && manifest.BaseBackup != "" {
+		base := filepath.Join(root, filepath.Base(manifest.BaseBackup))
+		if _, err := os.Stat(base); err != nil {
+			return nil, fmt.Errorf("base backup of %s: %w", dir, err)
+		}
+		return []string{base, dir}, nil
+	}
+
+	// 旧版差量备份没有清单，以它之前最近的全量备份为基准；目录名中的时间戳可以直接按字符串比较
+	timestamp := strings.TrimPrefix(name, "delta_")
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	base := ""
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "full_") {
+			continue
+		}
+		if strings.TrimPrefix(entry.Name(), "full_") < timestamp && entry.Name() > base {
+			base = entry.Name()
+		}
+	}
+	if base == "" {
+		return nil, fmt.Errorf("no full backup found before %s", dir)
+	}
+	return []string{filepath.Join(root, base), dir}, nil
+}
+
+// locateRestoreItems 在备份链中(从新到旧)查找每个 URI 对应的文件
+// 按 project/repo@digest 查找，Harbor 地址变化前后的备份可以组成同一条链
+func locateRestoreItems(chain []string, uris []string, opts restoreOptions) ([]restoreItem, []string, error) {
+	indexes := make([]map[string]restoreItem, len(chain))
+	for i, dir := range chain {
+		index, err := indexBackupDir(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		indexes[i] = index
+	}
+
+	var items []restoreItem
+	var missing []string
+	for _, uri := range uris {
+		ref, err := parseArtifactURI(uri)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !matchRestoreFilters(ref.Repository, opts) {
+			continue
+		}
+
+		found := false
+		for i := len(chain) - 1; i >= 0 && !found; i-- {
+			if item, ok := indexes[i][artifactKey(ref.Repository, ref.Digest)]; ok {
+				item.URI, item.Ref = uri, ref
+				items = append(items, item)
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, uri)
+		}
+	}
+	return items, missing, nil
+}
+
+// attachRestoreTags 从备份链的 backup_manifest.json 中取出每个制品在最后一次备份时的 tag，
+// 并返回多架构子制品所属的索引：tag 属于索引，在子制品之后随索引推送，子制品本身不推送 tag。
+// 没有清单的旧备份只按 digest 推送
+func attachRestoreTags(chain []string, items []restoreItem) ([]restoreIndex, error) {
+	artifacts, _, err := readBackupState(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags from backup manifests: %v", err)
+	}
+	tags := make(map[string][]string, len(artifacts))
+	for _, artifact := range artifacts {
+		if artifact.ParentDigest == "" {
+			tags[artifactKey(artifact.Repository, artifact.Digest)] = artifact.Tags
+		}
+	}
+	for i := range items {
+		items[i].Tags = tags[artifactKey(items[i].Ref.Repository, items[i].Ref.Digest)]
+	}
+	return locateRestoreIndexes(chain, artifacts, items), nil
+}
+
+// indexBackupDir 列出备份目录中可以恢复的制品，key 为 project/repo@digest
+func indexBackupDir(dir string) (map[string]restoreItem, error) {
+	index := make(map[string]restoreItem)
+
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err == nil {
+		refs, err := readOCILayoutIndex(dir)
+		if err != nil {
+			return nil, err
+		}
+		for uri, desc := range refs {
+			desc := desc
+			index[uriKey(uri)] = restoreItem{Source: dir, Layout: &desc}
+		}
+		return index, nil
+	}
+
+	// tar 格式：文件名由备份时的 URI 生成
+	artifacts, _, err := readBackupArtifacts(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		if artifact.Status != artifactStatusOK {
+			continue
+		}
+		fileName := artifact.File
+		if fileName == "" {
+			fileName = uriToFileName(artifact.URI) + ".tar"
+		}
+		filePath := filepath.Join(dir, filepath.FromSlash(fileName))
+		if _, err := os.Stat(filePath); err == nil {
+			index[uriKey(artifact.URI)] = restoreItem{Source: filePath}
+		}
+	}
+	return index, nil
+}
+
+// matchRestoreFilters 按项目和仓库通配符过滤
+func matchRestoreFilters(repository string, opts restoreOptions) bool {
+	return matchAnyPattern(projectOfRepository(repository), opts.Projects) &&
+		matchAnyPattern(repository, opts.Repositories)
+}
+
+// matchAnyPattern patterns 为空时匹配所有
+func matchAnyPattern(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// projectOfRepository 返回仓库名中的项目部分
+func projectOfRepository(repository string) string {
+	return strings.SplitN(repository, "/", 2)[0]
+}
+
+// pushRestoreItem 推送一个制品的全部 blob 和清单，返回推送后的清单 digest
+func pushRestoreItem(ctx context.Context, registry *registryClient, ref artifactRef, item restoreItem) (string, error) {
+	var src imageSource
+	var err error
+	if item.Layout != nil {
+		src, err = openOCILayoutImageSource(item.Source, *item.Layout)
+	} else {
+		src, err = openTarImageSource(item.Source)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	manifestBytes, manifestDesc, manifest := src.Manifest()
+	pushed := make(map[string]bool)
+	blobs := append([]descriptor{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		if pushed[blob.Digest] {
+			continue
+		}
+		err := registry.uploadBlob(ctx, ref.Host, ref.Repository, blob, func() (io.Reader, error) {
+			return src.OpenBlob(blob.Digest)
+		})
+		if err != nil {
+			return "", err
+		}
+		pushed[blob.Digest] = true
+	}
+
+	err = registry.putManifest(ctx, ref.Host, ref.Repository, manifestDesc.Digest, manifestDesc.MediaType, manifestBytes)
+	if err != nil {
+		return "", err
+	}
+	// 再按备份时的 tag 推送同一份清单
+	for _, tag := range item.Tags {
+		err := registry.putManifest(ctx, ref.Host, ref.Repository, tag, manifestDesc.MediaType, manifestBytes)
+		if err != nil {
+			return "", fmt.Errorf("failed to tag %s as %s: %w", ref, tag, err)
+		}
+	}
+	return manifestDesc.Digest, nil
+}
+
+// ensureProject 目标 Harbor 中不存在该项目时创建(私有项目)
+func ensureProject(ctx context.Context, client *harbor.Client, name string) error {
+	exists, err := client.ProjectExists(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error checking project %s: %w", name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	fmt.Printf("Creating project: %s\n", name)
+	if err := client.CreateProject(ctx, name, false); err != nil {
+		return fmt.Errorf("failed to create project %s: %w", name, err)
+	}
+	return nil
+}
+
+// printRestorePlan 打印 dry-run 的恢复清单
+func printRestorePlan(items []restoreItem, indexes []restoreIndex, missing []string) {
+	sort.Slice(items, func(i, j int) bool { return items[i].URI < items[j].URI })
+
+	fmt.Println("Artifacts to restore:")
+	for _, item := range items {
+		fmt.Printf("- %s\n  from: %s\n", item.URI, item.Source)
+		if len(item.Tags) > 0 {
+			fmt.Printf("  tags: %s\n", strings.Join(item.Tags, ", "))
+		}
+	}
+	if len(indexes) > 0 {
+		fmt.Println("\nMulti-arch indexes to push after their platforms:")
+		for _, index := range indexes {
+			fmt.Printf("- %s@%s\n", index.Repository, index.Digest)
+			if index.Source == "" {
+				fmt.Println("  WARNING: not in the backup, tags will NOT be restored")
+			} else if len(index.Tags) > 0 {
+				fmt.Printf("  tags: %s\n", strings.Join(index.Tags, ", "))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Println("\nArtifacts missing from backup:")
+		for _, uri := range missing {
+			fmt.Printf("- %s\n", uri)
+		}
+	}
+	fmt.Printf("\nTotal: %d to restore, %d missing\n", len(items), len(missing))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"harbor_api_mario/harbor"
+	"harbor_api_mario/internal/fakeharbor"
+)
+
+func TestRestorePushesRecordedTags(t *testing.T) {
+	source, sourceClient := newFakeHarbor(t)
+	nginx := source.PushImage("library/nginx", "1.25")
+	index, children := source.PushIndex("team/app", "v1", "linux/amd64", "linux/arm64", "unknown/unknown")
+	opts := nativeBackupOptions(t, sourceClient)
+	if err := downloadAndSaveAllArtifacts(context.Background(), sourceClient, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+	dir := onlyBackupDir(t, opts.Root, "full_")
+
+	target, targetClient := newFakeHarbor(t)
+	if err := restoreBackup(context.Background(), restoreOptions{BackupDir: dir, Target: targetClient}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if digest, ok := target.Tag("library/nginx", "1.25"); !ok || digest != nginx {
+		t.Errorf("library/nginx:1.25 on target = %s, %v; want %s", digest, ok, nginx)
+	}
+	if n := target.Requests("PUT", "/v2/library/nginx/manifests/1.25"); n != 1 {
+		t.Errorf("tag PUTs for library/nginx:1.25 = %d, want 1", n)
+	}
+	// 子清单(包括没有作为制品备份的 unknown/unknown)按 digest 推送，tag 打在原来的索引上
+	for _, child := range children {
+		if n := target.Requests("PUT", "/v2/team/app/manifests/"+child); n != 1 {
+			t.Errorf("manifest PUTs for team/app@%s = %d, want 1", child, n)
+		}
+	}
+	if digest, ok := target.Tag("team/app", "v1"); !ok || digest != index {
+		t.Errorf("team/app:v1 on target = %s, %v; want the index %s", digest, ok, index)
+	}
+}
+
+func TestRestoreWithoutIndexPushesPlatformsUntagged(t *testing.T) {
+	source, sourceClient := newFakeHarbor(t)
+	_, children := source.PushIndex("team/app", "v1", "linux/amd64", "linux/arm64")
+	opts := nativeBackupOptions(t, sourceClient)
+	if err := downloadAndSaveAllArtifacts(context.Background(), sourceClient, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+	// 保存索引之前的旧备份没有 indexes 目录
+	dir := onlyBackupDir(t, opts.Root, "full_")
+	if err := os.RemoveAll(filepath.Join(dir, indexesDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	target, targetClient := newFakeHarbor(t)
+	if err := restoreBackup(context.Background(), restoreOptions{BackupDir: dir, Target: targetClient}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	for _, child := range children {
+		if n := target.Requests("PUT", "/v2/team/app/manifests/"+child); n != 1 {
+			t.Errorf("manifest PUTs for team/app@%s = %d, want 1", child, n)
+		}
+	}
+	// 不能把索引的 tag 推到某一个平台上
+	if tags := target.Tags("team/app"); len(tags) != 0 {
+		t.Errorf("team/app tags on target = %v, want none", tags)
+	}
+}
+
+func TestRestoreWithoutManifestPushesDigestsOnly(t *testing.T) {
+	source, sourceClient := newFakeHarbor(t)
+	nginx := source.PushImage("library/nginx", "1.25")
+	opts := nativeBackupOptions(t, sourceClient)
+	if err := downloadAndSaveAllArtifacts(context.Background(), sourceClient, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+	// 旧版备份没有 backup_manifest.json
+	dir := onlyBackupDir(t, opts.Root, "full_")
+	if err := os.Remove(filepath.Join(dir, backupManifestFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	target, targetClient := newFakeHarbor(t)
+	if err := restoreBackup(context.Background(), restoreOptions{BackupDir: dir, Target: targetClient}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if n := target.Requests("PUT", "/v2/library/nginx/manifests/"+nginx); n != 1 {
+		t.Errorf("manifest PUTs by digest = %d, want 1", n)
+	}
+	if tags := target.Tags("library/nginx"); len(tags) != 0 {
+		t.Errorf("library/nginx tags on target = %v, want none", tags)
+	}
+}
+
+func TestRestoreWithTokenAuth(t *testing.T) {
+	source, sourceClient := newFakeHarbor(t)
+	nginx := source.PushImage("library/nginx", "1.25")
+	opts := nativeBackupOptions(t, sourceClient)
+	if err := downloadAndSaveAllArtifacts(context.Background(), sourceClient, opts); err != nil {
+		t.Fatalf("full backup: %v", err)
+	}
+
+	// 推送需要 pull,push scope 的 token
+	target := fakeharbor.NewTokenAuth()
+	t.Cleanup(target.Close)
+	targetClient, err := harbor.NewClient(target.BaseURL(), target.Credentials(), harbor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	dir := onlyBackupDir(t, opts.Root, "full_")
+	if err := restoreBackup(context.Background(), restoreOptions{BackupDir: dir, Target: targetClient}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if digest, ok := target.Tag("library/nginx", "1.25"); !ok || digest != nginx {
+		t.Errorf("library/nginx:1.25 on target = %s, %v; want %s", digest, ok, nginx)
+	}
+}
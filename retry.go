@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"harbor_api_mario/harbor"
+)
+
+// 幂等 API 请求和制品下载使用的重试策略，main 根据 -retries、-retry-delay 修改
+var defaultRetryPolicy = harbor.DefaultRetryPolicy
+
+func init() {
+	// API 请求的重试由 harbor 包完成，这里输出重试信息并计入运行结束时的汇总
+	defaultRetryPolicy.OnRetry = func(operation string, attempt int, delay time.Duration, reason string) {
+		fmt.Printf("Retrying %s in %s (attempt %d/%d): %s\n", operation, delay.Round(time.Millisecond), attempt, defaultRetryPolicy.MaxAttempts, reason)
+		retryStats.recordRetry(true)
+	}
+	defaultRetryPolicy.OnGiveUp = retryStats.recordFailure
+}
+
+// retry 按 defaultRetryPolicy 执行 fn，失败时重试，返回尝试次数和最后一次的错误；收到停止信号后不再重试
+func retry(ctx context.Context, operation string, fn func() error) (int, error) {
+	p := defaultRetryPolicy
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return attempt, nil
+		}
+		// 凭据、权限错误或制品已被删除时重试也不会成功
+		if harbor.IsPermanent(err) {
+			return attempt, err
+		}
+		if attempt >= p.MaxAttempts || stopping(ctx) {
+			break
+		}
+		delay := p.Backoff(attempt)
+		fmt.Printf("Retrying %s in %s (attempt %d/%d): %v\n", operation, delay.Round(time.Millisecond), attempt+1, p.MaxAttempts, err)
+		retryStats.recordRetry(false)
+		if sleepContext(ctx, delay) != nil {
+			return attempt, err
+		}
+	}
+	if p.MaxAttempts > 1 && !stopping(ctx) {
+		retryStats.recordFailure(operation, err)
+	}
+	return attempt, err
+}
+
+// retryCounter 统计本次运行中的重试，运行结束时输出汇总
+type retryCounter struct {
+	mu              sync.Mutex
+	apiRetries      int
+	artifactRetries int
+	failed          []string // 重试用尽后仍然失败的操作
+}
+
+var retryStats = &retryCounter{}
+
+func (s *retryCounter) recordRetry(api bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if api {
+		s.apiRetries++
+	} else {
+		s.artifactRetries++
+	}
+}
+
+func (s *retryCounter) recordFailure(operation string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, fmt.Sprintf("%s: %v", operation, err))
+}
+
+// printRetrySummary 输出重试汇总，没有发生重试时不输出
+func printRetrySummary() {
+	s := retryStats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.apiRetries == 0 && s.artifactRetries == 0 && len(s.failed) == 0 {
+		return
+	}
+	fmt.Printf("Retries: %d API requests, %d artifact downloads; %d operations failed after retries\n",
+		s.apiRetries, s.artifactRetries, len(s.failed))
+	for _, failure := range s.failed {
+		fmt.Printf("- failed: %s\n", failure)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// 支持的容器运行时，通过 -puller 选择
+const (
+	runtimeDocker  = "docker"
+	runtimePodman  = "podman"
+	runtimeNerdctl = "nerdctl" // containerd
+	runtimeSkopeo  = "skopeo"
+)
+
+// keepImages 为 true 时 save 和备份保留本次拉取到本地镜像存储的镜像，作为下次运行的缓存；
+// 为 false 时每次保存结束后(包括失败)删除它们。main 根据 -keep-images 设置
+var keepImages bool
+
+// containerRuntime 调用本机容器运行时的命令行拉取和保存镜像。
+// Save 与 nativePuller 一样输出可以 docker load 的 tar，用于 save 和各种备份；Pull 用于 pull 操作
+type containerRuntime interface {
+	artifactPuller
+	// Name 返回运行时的名称，如 docker
+	Name() string
+	// Pull 把镜像拉取到运行时的本地镜像存储
+	Pull(ctx context.Context, uri string) error
+}
+
+// newContainerRuntime 根据名称创建容器运行时，keep 为 false 时保存后删除本次拉取的镜像
+func newContainerRuntime(name string, keep bool) (containerRuntime, error) {
+	switch name {
+	case runtimeDocker, runtimePodman, runtimeNerdctl:
+		return &cliRuntime{binary: name, keepImages: keep}, nil
+	case runtimeSkopeo:
+		return skopeoRuntime{}, nil
+	default:
+		return nil, fmt.Errorf("unknown container runtime: %s (supported: docker, podman, nerdctl, skopeo)", name)
+	}
+}
+
+// newPullRuntime 返回 pull 操作使用的运行时：-puller 为 native 时与以前一样使用 docker；
+// skopeo 没有本地镜像存储，不能用于 pull
+func newPullRuntime(name string) (containerRuntime, error) {
+	if name == "" || name == "native" {
+		name = runtimeDocker
+	}
+	if name == runtimeSkopeo {
+		return nil, fmt.Errorf("skopeo has no local image store, use -puller docker, podman or nerdctl for pull")
+	}
+	// pull 的目的就是把镜像留在本地
+	return newContainerRuntime(name, true)
+}
+
+// cliRuntime 命令行与 docker 兼容的运行时：docker、podman 和 nerdctl(containerd)
+// nerdctl 使用的 containerd 命名空间由 CONTAINERD_NAMESPACE 环境变量指定
+type cliRuntime struct {
+	binary     string
+	keepImages bool
+}
+
+func (r *cliRuntime) Name() string { return r.binary }
+
+func (r *cliRuntime) Pull(ctx context.Context, uri string) error {
+	output, err := runRuntime(ctx, r.binary, "pull", uri)
+	if err != nil {
+		return fmt.Errorf("failed to download artifact %s: %v\nOutput: %s", uri, err, output)
+	}
+	return nil
+}
+
+func (r *cliRuntime) Save(ctx context.Context, uri, filePath string) error {
+	// 拉取前本地没有这个镜像时，无论保存成功、失败还是被中止，返回前都删除它
+	if !r.keepImages {
+		present := r.imageExists(ctx, uri)
+		if err := ctx.Err(); err != nil {
+			// 检查被中止时无法确定镜像原来是否存在，不能删除
+			return err
+		}
+		if !present {
+			defer r.removeImage(uri)
+		}
+	}
+	if err := r.Pull(ctx, uri); err != nil {
+		return err
+	}
+	output, err := runRuntime(ctx, r.binary, "save", "-o", filePath, uri)
+	if err != nil {
+		// save 被中止时会留下不完整的 tar
+		os.Remove(filePath)
+		return fmt.Errorf("failed to save artifact %s: %v\nOutput: %s", uri, err, output)
+	}
+	return nil
+}
+
+// imageExists 检查镜像是否已在本地镜像存储中
+func (r *cliRuntime) imageExists(ctx context.Context, uri string) bool {
+	_, err := runRuntime(ctx, r.binary, "image", "inspect", uri)
+	return err == nil
+}
+
+// removeImage 删除本次拉取的镜像；拉取失败时镜像不存在，不需要删除。
+// 使用独立的 context，运行被中止时也会清理；删除失败只打印警告，不影响已经保存的文件
+func (r *cliRuntime) removeImage(uri string) {
+	ctx := context.Background()
+	if !r.imageExists(ctx, uri) {
+		return
+	}
+	output, err := runRuntime(ctx, r.binary, "rmi", uri)
+	if err != nil {
+		fmt.Printf("Warning: failed to remove local image %s: %v\nOutput: %s\n", uri, err, output)
+		return
+	}
+	fmt.Printf("Removed local image: %s\n", uri)
+}
+
+// skopeoRuntime 用 skopeo copy 把镜像从 Harbor 直接复制为 docker-archive，
+// 不需要守护进程，也不会在本机留下镜像
+type skopeoRuntime struct{}
+
+func (skopeoRuntime) Name() string { return runtimeSkopeo }
+
+func (skopeoRuntime) Pull(ctx context.Context, uri string) error {
+	return fmt.Errorf("failed to download artifact %s: skopeo has no local image store", uri)
+}
+
+func (skopeoRuntime) Save(ctx context.Context, uri, filePath string) error {
+	// skopeo 不会覆盖已有的 docker-archive，重试前删除上次留下的文件
+	os.Remove(filePath)
+	output, err := runRuntime(ctx, runtimeSkopeo, "copy", "docker://"+uri, "docker-archive:"+filePath)
+	if err != nil {
+		os.Remove(filePath)
+		return fmt.Errorf("failed to save artifact %s: %v\nOutput: %s", uri, err, output)
+	}
+	return nil
+}
+
+// runRuntime 执行运行时命令，返回合并的标准输出和标准错误
+func runRuntime(ctx context.Context, binary string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, binary, args...)
+	detachProcessGroup(cmd)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
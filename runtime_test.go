@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"harbor_api_mario/internal/fakeharbor"
+)
+
+// installRuntimeShim 把名为 name 的运行时 shim 放在 PATH 的最前面，返回它的调用日志
+func installRuntimeShim(t *testing.T, name string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the runtime shim is a shell script")
+	}
+	bin := t.TempDir()
+	logPath, err := fakeharbor.WriteRuntimeShim(bin, name)
+	if err != nil {
+		t.Fatalf("WriteRuntimeShim: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+func TestContainerRuntimeSave(t *testing.T) {
+	const uri = "harbor.example.com/library/nginx@sha256:0123"
+	tests := []struct {
+		name string
+		want func(file string) []string
+	}{
+		{runtimeDocker, func(file string) []string { return []string{"pull " + uri, "save -o " + file + " " + uri} }},
+		{runtimePodman, func(file string) []string { return []string{"pull " + uri, "save -o " + file + " " + uri} }},
+		{runtimeNerdctl, func(file string) []string { return []string{"pull " + uri, "save -o " + file + " " + uri} }},
+		{runtimeSkopeo, func(file string) []string { return []string{"copy docker://" + uri + " docker-archive:" + file} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath := installRuntimeShim(t, tt.name)
+			rt, err := newContainerRuntime(tt.name, true)
+			if err != nil {
+				t.Fatalf("newContainerRuntime: %v", err)
+			}
+
+			file := filepath.Join(t.TempDir(), "nginx.tar")
+			if err := rt.Save(context.Background(), uri, file); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if data, err := ioutil.ReadFile(file); err != nil || len(data) == 0 {
+				t.Errorf("saved archive: %q, %v", data, err)
+			}
+			calls, err := fakeharbor.RuntimeCalls(logPath)
+			if err != nil {
+				t.Fatalf("RuntimeCalls: %v", err)
+			}
+			if want := tt.want(file); !reflect.DeepEqual(calls, want) {
+				t.Errorf("%s calls = %q, want %q", tt.name, calls, want)
+			}
+		})
+	}
+}
+
+func TestNewPullRuntime(t *testing.T) {
+	for name, want := range map[string]string{"": runtimeDocker, "native": runtimeDocker, runtimePodman: runtimePodman, runtimeNerdctl: runtimeNerdctl} {
+		rt, err := newPullRuntime(name)
+		if err != nil || rt.Name() != want {
+			t.Errorf("newPullRuntime(%q) = %v, %v; want %s", name, rt, err, want)
+		}
+	}
+	if _, err := newPullRuntime(runtimeSkopeo); err == nil {
+		t.Error("newPullRuntime(skopeo) succeeded, want an error because skopeo cannot pull into a local store")
+	}
+	if _, err := newArtifactPuller("rkt", nil); err == nil {
+		t.Error("newArtifactPuller(rkt) succeeded, want an error")
+	}
+}
+
+func TestContainerRuntimeRemovesPulledImages(t *testing.T) {
+	const (
+		cached = "harbor.example.com/library/nginx@sha256:0123"
+		pulled = "harbor.example.com/library/redis@sha256:4567"
+	)
+	tests := []struct {
+		keep       bool
+		wantImages []string
+	}{
+		{false, []string{cached}},
+		{true, []string{cached, pulled}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("keep=%v", tt.keep), func(t *testing.T) {
+			logPath := installRuntimeShim(t, runtimeDocker)
+			if err := fakeharbor.AddRuntimeImage(logPath, cached); err != nil {
+				t.Fatalf("AddRuntimeImage: %v", err)
+			}
+			rt, err := newContainerRuntime(runtimeDocker, tt.keep)
+			if err != nil {
+				t.Fatalf("newContainerRuntime: %v", err)
+			}
+
+			dir := t.TempDir()
+			for _, uri := range []string{cached, pulled} {
+				if err := rt.Save(context.Background(), uri, filepath.Join(dir, uriToFileName(uri)+".tar")); err != nil {
+					t.Fatalf("Save(%s): %v", uri, err)
+				}
+			}
+			// 运行前已在本地的镜像保留，本次拉取的镜像只有 keep 为 false 时删除
+			images, err := fakeharbor.RuntimeImages(logPath)
+			if err != nil {
+				t.Fatalf("RuntimeImages: %v", err)
+			}
+			if !reflect.DeepEqual(images, tt.wantImages) {
+				t.Errorf("local images = %q, want %q", images, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestContainerRuntimeRemovesPulledImageWhenSaveFails(t *testing.T) {
+	const (
+		cached = "harbor.example.com/library/nginx@sha256:0123"
+		pulled = "harbor.example.com/library/redis@sha256:4567"
+	)
+	logPath := installRuntimeShim(t, runtimeDocker)
+	if err := fakeharbor.AddRuntimeImage(logPath, cached); err != nil {
+		t.Fatalf("AddRuntimeImage: %v", err)
+	}
+	t.Setenv(fakeharbor.RuntimeFailEnv, "save")
+	rt, err := newContainerRuntime(runtimeDocker, false)
+	if err != nil {
+		t.Fatalf("newContainerRuntime: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, uri := range []string{cached, pulled} {
+		if err := rt.Save(context.Background(), uri, filepath.Join(dir, uriToFileName(uri)+".tar")); err == nil {
+			t.Fatalf("Save(%s) succeeded, want the injected save failure", uri)
+		}
+	}
+	// 保存失败时本次拉取的镜像同样被删除，运行前已有的镜像保留
+	images, err := fakeharbor.RuntimeImages(logPath)
+	if err != nil {
+		t.Fatalf("RuntimeImages: %v", err)
+	}
+	if !reflect.DeepEqual(images, []string{cached}) {
+		t.Errorf("local images = %q, want only %s", images, cached)
+	}
+}
@@ -7,28 +7,28 @@ BACKUP_DATA_DIR="/data/harbor_backups/artifacts"
 # 设置保留天数
 RETENTION_DAYS=30
 
-# 从环境变量中获取 harbor host 和认证信息
+# 从环境变量中获取 harbor host；认证信息可以是 HARBOR_USERNAME/HARBOR_PASSWORD、HARBOR_TOKEN、
+# HARBOR_AUTH、HARBOR_CREDENTIALS_FILE 指定的凭据文件或 docker login 保存的凭据，由程序自行查找
 HARBOR_BASEURL="${HARBOR_BASEURL}"
-HARBOR_AUTH="${HARBOR_AUTH}"
 
 # 加载变量
 source ~/.bashrc
 
 # 检查环境变量是否设置
-if [ -z "$HARBOR_BASEURL" ] || [ -z "$HARBOR_AUTH" ]; then
-  echo "Error: HARBOR_BASEURL or HARBOR_AUTH environment variables are not set."
+if [ -z "$HARBOR_BASEURL" ]; then
+  echo "Error: HARBOR_BASEURL environment variable is not set."
   exit 1
 fi
 
 # 根据日期决定执行全量备份或差量备份
 DAY_OF_WEEK=$(date +%u)
 
-# 注意脚本 harbor_api_mario 中使用的是相对路径 所以备份时一定要切换到指定路径执行
-# 不能使用绝对路径执行 harbor_api_mario 否则会在执行脚本的路径生成备份文件夹
+# 通过 --backup-root 指定备份根目录，备份目录、last_full_backup_path.txt 和备份链索引都在其中
+# 仍然切换到 $BACKUP_ROOT 执行，以便读取旧版本写在该目录下的 last_full_backup_path.txt
 if [ "$DAY_OF_WEEK" -eq 7 ]; then
   # 周日执行全量备份
   echo "Executing full backup..."
-  cd "$BACKUP_ROOT" && ./harbor_api_mario --action full_backup
+  cd "$BACKUP_ROOT" && ./harbor_api_mario --action full_backup --backup-root "$BACKUP_DATA_DIR"
   if [ $? -ne 0 ]; then
     echo "Error: Full backup failed."
     exit 1
@@ -36,16 +36,20 @@ if [ "$DAY_OF_WEEK" -eq 7 ]; then
 else
   # 周一到周六执行差量备份
   echo "Executing delta backup..."
-  cd "$BACKUP_ROOT" && ./harbor_api_mario --action delta_backup
+  cd "$BACKUP_ROOT" && ./harbor_api_mario --action delta_backup --backup-root "$BACKUP_DATA_DIR"
   if [ $? -ne 0 ]; then
     echo "Error: Delta backup failed."
     exit 1
   fi
 fi
 
-# 清理指定天数之前的备份文件
+# 清理指定天数之前的备份，被保留的差量备份依赖的全量备份不会被删除
 echo "Cleaning up old backups..."
-find "$BACKUP_DATA_DIR" -type d -mtime +"$RETENTION_DAYS" -exec rm -rf {} \;
+cd "$BACKUP_ROOT" && ./harbor_api_mario --action prune --backup-root "$BACKUP_DATA_DIR" --keep-days "$RETENTION_DAYS"
+if [ $? -ne 0 ]; then
+  echo "Error: Cleanup failed."
+  exit 1
+fi
 
 # 记录清理操作
 echo "Cleanup completed on $(date)" >> "$BACKUP_ROOT"/cleanup.log
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// errInterrupted 表示操作因收到 SIGINT/SIGTERM 而提前结束
+var errInterrupted = errors.New("interrupted by signal")
+
+type drainKey struct{}
+
+// withDrain 返回的 context 可以先被"排空"：drain 之后不再开始新的工作，
+// 但 context 本身不会被取消，正在进行的请求可以继续完成
+func withDrain(parent context.Context) (context.Context, func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	return context.WithValue(parent, drainKey{}, (<-chan struct{})(done)), func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// stopping 返回 true 表示已收到停止信号，不应再开始新的工作
+func stopping(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	if done, ok := ctx.Value(drainKey{}).(<-chan struct{}); ok {
+		select {
+		case <-done:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// checkInterrupted 在开始新的工作(如下一页查询)之前调用
+func checkInterrupted(ctx context.Context) error {
+	if stopping(ctx) {
+		return errInterrupted
+	}
+	return nil
+}
+
+// sleepContext 等待 d，context 取消时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleShutdownSignals 返回随 SIGINT/SIGTERM 停止的 context：
+// 第一次信号后不再开始新的工作，正在保存的制品继续完成；
+// 第二次信号取消 context，中止正在进行的请求和 docker 子进程，未完成的文件会被删除。
+// interrupted 只在真正收到过信号时返回 true；stop 也会取消 context，不能用 ctx.Err() 判断
+func handleShutdownSignals() (ctx context.Context, stop func(), interrupted func() bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, drain := withDrain(ctx)
+
+	var received atomic.Bool
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig, ok := <-signals
+		if !ok {
+			return
+		}
+		received.Store(true)
+		fmt.Printf("Received %s, finishing in-flight work; send it again to abort immediately\n", sig)
+		drain()
+		sig, ok = <-signals
+		if !ok {
+			return
+		}
+		fmt.Printf("Received %s again, aborting in-flight work\n", sig)
+		cancel()
+	}()
+
+	stop = func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel()
+	}
+	return ctx, stop, received.Load
+}
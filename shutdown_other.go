@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// detachProcessGroup 在其他平台上不做处理
+func detachProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcessGroup 让子进程使用独立的进程组，终端的 Ctrl-C 不会直接发给它，
+// 由 context 决定何时结束子进程
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
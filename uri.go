@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net/url"
+
+	"harbor_api_mario/harbor"
 )
 
-func fetchAllURIs(baseURL, auth string) (
+func fetchAllURIs(ctx context.Context, client *harbor.Client) (
 	singleArchURIs []string,
 	multiArchURIs []string,
 	multiArchWithChildURIs []string,
@@ -14,30 +16,21 @@ func fetchAllURIs(baseURL, auth string) (
 	unknownArchURIs []string,
 	err error,
 ) {
-	// 解析 baseURL 以提取 harborHost
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("invalid baseURL: %v", err)
-	}
-	harborHost := fmt.Sprintf("%s", u.Host)
-
-	repositories, err := fetchAllRepositories(baseURL, auth)
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
-	}
-
-	artifacts, err := fetchAllArtifacts(baseURL, auth)
+	// 遍历一次 Harbor，harborHost 取自 API 地址
+	inv, err := fetchInventory(ctx, client, nil)
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, err
 	}
+	harborHost := inv.Host
 
 	// 遍历所有制品
-	for _, artifact := range artifacts {
+	for _, artifact := range inv.AllArtifacts() {
 		// 根据制品的 RepositoryID 获取 RepositoryName
-		repoName := getRepoNameByID(artifact.RepositoryID, repositories)
-		if repoName == "" {
+		repository, ok := inv.Repository(artifact.RepositoryID)
+		if !ok {
 			return nil, nil, nil, nil, nil, nil, fmt.Errorf("repository name not found for repository ID: %d", artifact.RepositoryID)
 		}
+		repoName := repository.Name
 
 		if len(artifact.References) == 0 {
 			// 单架构制品
@@ -71,48 +64,48 @@ func fetchAllURIs(baseURL, auth string) (
 	return singleArchURIs, multiArchURIs, multiArchWithChildURIs, allURIs, nonUnknownArchURIs, unknownArchURIs, nil
 }
 
-func fetchSingleArchURIs(baseURL, auth string) ([]string, error) {
-	singleArchURIs, _, _, _, _, _, err := fetchAllURIs(baseURL, auth)
+func fetchSingleArchURIs(ctx context.Context, client *harbor.Client) ([]string, error) {
+	singleArchURIs, _, _, _, _, _, err := fetchAllURIs(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 	return singleArchURIs, nil
 }
 
-func fetchMultiArchURIs(baseURL, auth string) ([]string, error) {
-	_, multiArchURIs, _, _, _, _, err := fetchAllURIs(baseURL, auth)
+func fetchMultiArchURIs(ctx context.Context, client *harbor.Client) ([]string, error) {
+	_, multiArchURIs, _, _, _, _, err := fetchAllURIs(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 	return multiArchURIs, nil
 }
 
-func fetchMultiArchWithChildURIs(baseURL, auth string) ([]string, error) {
-	_, _, multiArchWithChildURIs, _, _, _, err := fetchAllURIs(baseURL, auth)
+func fetchMultiArchWithChildURIs(ctx context.Context, client *harbor.Client) ([]string, error) {
+	_, _, multiArchWithChildURIs, _, _, _, err := fetchAllURIs(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 	return multiArchWithChildURIs, nil
 }
 
-func fetchAllURIsList(baseURL, auth string) ([]string, error) {
-	_, _, _, allURIs, _, _, err := fetchAllURIs(baseURL, auth)
+func fetchAllURIsList(ctx context.Context, client *harbor.Client) ([]string, error) {
+	_, _, _, allURIs, _, _, err := fetchAllURIs(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 	return allURIs, nil
 }
 
-func fetchNonUnknownArchURIs(baseURL, auth string) ([]string, error) {
-	_, _, _, _, nonUnknownArchURIs, _, err := fetchAllURIs(baseURL, auth)
+func fetchNonUnknownArchURIs(ctx context.Context, client *harbor.Client) ([]string, error) {
+	_, _, _, _, nonUnknownArchURIs, _, err := fetchAllURIs(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 	return nonUnknownArchURIs, nil
 }
 
-func fetchUnknownArchURIs(baseURL, auth string) ([]string, error) {
-	_, _, _, _, _, unknownArchURIs, err := fetchAllURIs(baseURL, auth)
+func fetchUnknownArchURIs(ctx context.Context, client *harbor.Client) ([]string, error) {
+	_, _, _, _, _, unknownArchURIs, err := fetchAllURIs(ctx, client)
 	if err != nil {
 		return nil, err
 	}
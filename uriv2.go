@@ -1,74 +1,120 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net/url"
+	"time"
+
+	"harbor_api_mario/harbor"
 )
 
-func fetchAllArtifactsWithTypes(baseURL, auth string) (map[string][]string, error) {
-	// 解析 baseURL 以提取 harborHost
-	u, err := url.Parse(baseURL)
+// fetchAllArtifactsWithTypes 遍历一次 Harbor，返回按架构类型分类的 URI 列表
+func fetchAllArtifactsWithTypes(ctx context.Context, client *harbor.Client) (map[string][]string, error) {
+	inv, err := fetchInventory(ctx, client, nil)
 	if err != nil {
-		return nil, fmt.Errorf("invalid baseURL: %v", err)
+		return nil, err
 	}
-	harborHost := fmt.Sprintf("%s", u.Host)
 
-	repositories, err := fetchAllRepositories(baseURL, auth)
-	if err != nil {
-		return nil, err
+	// 返回存储 URI 列表的 map 和错误信息
+	return inventoryURIs(inv)
+}
+
+// fetchBackupArtifacts 获取需要备份的制品(与 non_unknown_arch_uris 相同)，并带上仓库、tag 等信息
+func fetchBackupArtifacts(ctx context.Context, client *harbor.Client) ([]BackupArtifact, error) {
+	return fetchChangedBackupArtifacts(ctx, client, nil)
+}
+
+// fetchChangedBackupArtifacts 与 fetchBackupArtifacts 相同，但只查询有变化的仓库：
+// 仓库的 update_time 不晚于 previous 中该仓库最新的 push_time 时，说明之后没有新的推送，
+// 直接沿用 previous 中的制品(URI 换成当前的 Harbor 地址)。previous 为空时查询全部仓库
+func fetchChangedBackupArtifacts(ctx context.Context, client *harbor.Client, previous []BackupArtifact) ([]BackupArtifact, error) {
+	previousByRepo := make(map[string][]BackupArtifact)
+	latestPush := make(map[string]time.Time)
+	for _, artifact := range previous {
+		previousByRepo[artifact.Repository] = append(previousByRepo[artifact.Repository], artifact)
+		if pushTime, err := time.Parse(time.RFC3339Nano, artifact.PushTime); err == nil && pushTime.After(latestPush[artifact.Repository]) {
+			latestPush[artifact.Repository] = pushTime
+		}
 	}
 
-	artifacts, err := fetchAllArtifacts(baseURL, auth)
+	// 没有变化的仓库不查询制品
+	unchanged := func(repository harbor.Repository) bool {
+		updateTime, err := time.Parse(time.RFC3339Nano, repository.UpdateTime)
+		if err != nil {
+			return false
+		}
+		latest, ok := latestPush[repository.Name]
+		return ok && !updateTime.After(latest)
+	}
+	inv, err := fetchInventory(ctx, client, unchanged)
 	if err != nil {
 		return nil, err
 	}
 
-	// 初始化存储 URI 列表的 map
-	uriMap := map[string][]string{
-		"single_architecture":   {},
-		"multi_architecture":    {},
-		"multi_arch_with_child": {},
-		"all_uris":              {},
-		"non_unknown_arch_uris": {},
-		"unknown_arch_uris":     {},
-	}
-
-	// 遍历所有制品
-	for _, artifact := range artifacts {
-		// 根据制品的 RepositoryID 获取 RepositoryName
-		repoName := getRepoNameByID(artifact.RepositoryID, repositories)
-		if repoName == "" {
-			return nil, fmt.Errorf("repository name not found for repository ID: %d", artifact.RepositoryID)
+	var backupArtifacts []BackupArtifact
+	skipped := 0
+	for _, repository := range inv.Repositories {
+		if unchanged(repository) {
+			for _, artifact := range previousByRepo[repository.Name] {
+				artifact.URI = fmt.Sprintf("%s/%s@%s", inv.Host, artifact.Repository, artifact.Digest)
+				artifact.File, artifact.FileSize, artifact.SHA256, artifact.Error, artifact.Attempts = "", 0, "", "", 0
+				backupArtifacts = append(backupArtifacts, artifact)
+			}
+			skipped++
+			continue
 		}
+		backupArtifacts = append(backupArtifacts, inventoryBackupArtifacts(inv, repository)...)
+	}
+	if previous != nil {
+		fmt.Printf("Queried %d repositories, %d unchanged since last backup\n", len(inv.Repositories)-skipped, skipped)
+	}
 
-		if len(artifact.References) == 0 {
-			// 单架构制品
-			uri := fmt.Sprintf("%s/%s@%s", harborHost, repoName, artifact.Digest)
-			uriMap["single_architecture"] = append(uriMap["single_architecture"], uri)
-			uriMap["all_uris"] = append(uriMap["all_uris"], uri)
-			uriMap["non_unknown_arch_uris"] = append(uriMap["non_unknown_arch_uris"], uri)
-		} else {
-			// 多架构制品
-			uri := fmt.Sprintf("%s/%s@%s", harborHost, repoName, artifact.Digest)
-			uriMap["multi_architecture"] = append(uriMap["multi_architecture"], uri)
-
-			for _, reference := range artifact.References {
-				childURI := fmt.Sprintf("%s/%s@%s::%s", harborHost, repoName, artifact.Digest, reference.ChildDigest)
-				uriMap["multi_arch_with_child"] = append(uriMap["multi_arch_with_child"], childURI)
+	return backupArtifacts, nil
+}
 
-				childDigestURI := fmt.Sprintf("%s/%s@%s", harborHost, repoName, reference.ChildDigest)
+// toBackupArtifacts 把 Harbor 制品转换为备份清单中的制品
+// 多架构制品只备份已知平台的子制品，tag 和推送时间取自父制品
+func toBackupArtifacts(harborHost, repoName string, artifact harbor.Artifact) []BackupArtifact {
+	var tags []string
+	for _, tag := range artifact.Tags {
+		tags = append(tags, tag.Name)
+	}
 
-				if reference.Platform.Architecture != "unknown" && reference.Platform.Os != "unknown" {
-					uriMap["non_unknown_arch_uris"] = append(uriMap["non_unknown_arch_uris"], childDigestURI)
-				} else {
-					uriMap["unknown_arch_uris"] = append(uriMap["unknown_arch_uris"], childDigestURI)
-				}
+	if len(artifact.References) == 0 {
+		// 单架构制品
+		return []BackupArtifact{{
+			URI:        fmt.Sprintf("%s/%s@%s", harborHost, repoName, artifact.Digest),
+			Repository: repoName,
+			Digest:     artifact.Digest,
+			Tags:       tags,
+			Size:       int64(artifact.Size),
+			PushTime:   artifact.PushTime,
+		}}
+	}
 
-				uriMap["all_uris"] = append(uriMap["all_uris"], childDigestURI)
-			}
+	var backupArtifacts []BackupArtifact
+	for _, reference := range artifact.References {
+		if reference.Platform.Architecture == "unknown" || reference.Platform.Os == "unknown" {
+			continue
 		}
+		backupArtifacts = append(backupArtifacts, BackupArtifact{
+			URI:          fmt.Sprintf("%s/%s@%s", harborHost, repoName, reference.ChildDigest),
+			Repository:   repoName,
+			Digest:       reference.ChildDigest,
+			ParentDigest: artifact.Digest,
+			Platform:     formatPlatform(reference.Platform),
+			Tags:         tags,
+			PushTime:     artifact.PushTime,
+		})
 	}
+	return backupArtifacts
+}
 
-	// 返回存储 URI 列表的 map 和错误信息
-	return uriMap, nil
+// formatPlatform 格式化为 os/architecture[/variant]
+func formatPlatform(p harbor.Platform) string {
+	platform := p.Os + "/" + p.Architecture
+	if p.Variant != "" {
+		platform += "/" + p.Variant
+	}
+	return platform
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"harbor_api_mario/harbor"
+	"harbor_api_mario/internal/fakeharbor"
+)
+
+// newFakeHarbor 启动一个假的 Harbor 并创建访问它的客户端，测试结束时关闭
+func newFakeHarbor(t *testing.T) (*fakeharbor.Server, *harbor.Client) {
+	t.Helper()
+	fake := fakeharbor.New()
+	t.Cleanup(fake.Close)
+	client, err := harbor.NewClient(fake.BaseURL(), fake.Credentials(), harbor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return fake, client
+}
+
+func TestFetchAllArtifactsWithTypes(t *testing.T) {
+	fake, client := newFakeHarbor(t)
+	single := fake.PushImage("library/nginx", "1.25")
+	index, children := fake.PushIndex("team/tools/app", "v1", "linux/amd64", "linux/arm64", "unknown/unknown")
+
+	uriMap, err := fetchAllArtifactsWithTypes(context.Background(), client)
+	if err != nil {
+		t.Fatalf("fetchAllArtifactsWithTypes: %v", err)
+	}
+
+	singleURI := fake.URI("library/nginx", single)
+	childURIs := make([]string, len(children))
+	for i, child := range children {
+		childURIs[i] = fake.URI("team/tools/app", child)
+	}
+	want := map[string][]string{
+		"single_architecture": {singleURI},
+		"multi_architecture":  {fake.URI("team/tools/app", index)},
+		"multi_arch_with_child": {
+			fake.URI("team/tools/app", index) + "::" + children[0],
+			fake.URI("team/tools/app", index) + "::" + children[1],
+			fake.URI("team/tools/app", index) + "::" + children[2],
+		},
+		"all_uris":              {singleURI, childURIs[0], childURIs[1], childURIs[2]},
+		"non_unknown_arch_uris": {singleURI, childURIs[0], childURIs[1]},
+		"unknown_arch_uris":     {childURIs[2]},
+	}
+	for key, uris := range want {
+		got := append([]string(nil), uriMap[key]...)
+		sort.Strings(got)
+		sort.Strings(uris)
+		if !reflect.DeepEqual(got, uris) {
+			t.Errorf("%s = %v, want %v", key, got, uris)
+		}
+	}
+}
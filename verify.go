@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"harbor_api_mario/harbor"
+)
+
+// verifyOptions 校验备份的选项
+type verifyOptions struct {
+	BackupDir string
+	// Drift 为 true 时与 Harbor 当前的制品列表比较
+	Drift  bool
+	Client *harbor.Client // Drift 为 true 时查询制品列表的客户端
+}
+
+// verifyBackup 校验备份目录的完整性，返回发现的所有问题
+// 差量备份会连同它依赖的全量备份一起校验
+func verifyBackup(ctx context.Context, opts verifyOptions) ([]string, error) {
+	dir := filepath.Clean(opts.BackupDir)
+	chain, err := resolveBackupChain(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, chainDir := range chain {
+		fmt.Printf("Verifying %s\n", chainDir)
+		dirProblems, err := verifyBackupDir(chainDir)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, dirProblems...)
+	}
+
+	// all_uri_list.txt 中的每个 URI 都必须能在备份链中找到文件
+	uris, err := readURIsFromFile(filepath.Join(dir, "all_uri_list.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read URI list: %v", err)
+	}
+	_, missing, err := locateRestoreItems(chain, uris, restoreOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, uri := range missing {
+		problems = append(problems, fmt.Sprintf("no file for %s in %s", uri, strings.Join(chain, ", ")))
+	}
+	fmt.Printf("Checked %d URIs against backup chain %s\n", len(uris), strings.Join(chain, " -> "))
+
+	// 可选：与 Harbor 当前的制品比较
+	if opts.Drift {
+		driftProblems, err := verifyDrift(ctx, opts.Client, uris)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, driftProblems...)
+	}
+
+	return problems, nil
+}
+
+// verifyBackupDir 校验单个备份目录中的文件：摘要、tar / OCI 布局结构和遗留的临时文件
+func verifyBackupDir(dir string) ([]string, error) {
+	var problems []string
+
+	manifest, err := readBackupManifest(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if manifest != nil {
+		problems = append(problems, verifyManifestFiles(dir, manifest)...)
+	} else {
+		fmt.Printf("No %s in %s, checking file structure only.\n", backupManifestFile, dir)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err == nil {
+		problems = append(problems, verifyOCILayout(dir)...)
+	} else {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tar"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if err := verifyImageArchive(file); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid archive %s: %v", file, err))
+			}
+		}
+	}
+
+	partials, err := findPartialFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, partial := range partials {
+		problems = append(problems, fmt.Sprintf("leftover partial file: %s", partial))
+	}
+	return problems, nil
+}
+
+// verifyManifestFiles 检查清单中每个制品的状态和文件摘要
+func verifyManifestFiles(dir string, manifest *BackupManifest) []string {
+	var problems []string
+	if manifest.Status == backupStatusInProgress || manifest.Status == backupStatusInterrupted {
+		problems = append(problems, fmt.Sprintf("backup %s did not complete, continue it with -resume", dir))
+	}
+	for _, artifact := range manifest.Artifacts {
+		if artifact.Status != artifactStatusOK {
+			reason := artifact.Status
+			if artifact.Error != "" {
+				reason += ": " + artifact.Error
+			}
+			problems = append(problems, fmt.Sprintf("artifact %s was not saved (%s)", artifact.URI, reason))
+			continue
+		}
+
+		filePath := filepath.Join(dir, filepath.FromSlash(artifact.File))
+		sum, size, err := hashFile(filePath)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot read %s: %v", filePath, err))
+			continue
+		}
+		if sum != artifact.SHA256 || size != artifact.FileSize {
+			problems = append(problems, fmt.Sprintf("checksum mismatch for %s: expected sha256 %s (%d bytes), got %s (%d bytes)",
+				filePath, artifact.SHA256, artifact.FileSize, sum, size))
+		}
+	}
+	fmt.Printf("Checked %d artifacts recorded in %s\n", len(manifest.Artifacts), backupManifestFile)
+	return problems
+}
+
+// verifyImageArchive 检查镜像 tar 的结构：清单可解析，引用的 blob 都存在且大小一致
+func verifyImageArchive(filePath string) error {
+	src, err := openTarImageSource(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, _, manifest := src.Manifest()
+	blobs := append([]descriptor{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		name, ok := src.blobs[blob.Digest]
+		if !ok {
+			return fmt.Errorf("missing blob %s", blob.Digest)
+		}
+		if size := src.entries[name].Size(); size != blob.Size {
+			return fmt.Errorf("blob %s has %d bytes, expected %d", blob.Digest, size, blob.Size)
+		}
+	}
+	return nil
+}
+
+// verifyOCILayout 检查 OCI 布局：index.json 引用的清单以及清单引用的 blob 都存在且摘要正确
+func verifyOCILayout(dir string) []string {
+	refs, err := readOCILayoutIndex(dir)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid OCI layout %s: %v", dir, err)}
+	}
+
+	var problems []string
+	checked := make(map[string]bool)
+	checkBlob := func(blob descriptor) bool {
+		if checked[blob.Digest] {
+			return true
+		}
+		checked[blob.Digest] = true
+		if err := verifyBlobFile(dir, blob); err != nil {
+			problems = append(problems, err.Error())
+			return false
+		}
+		return true
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		desc := refs[name]
+		if !checkBlob(desc) {
+			continue
+		}
+		src, err := openOCILayoutImageSource(dir, desc)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid manifest for %s: %v", name, err))
+			continue
+		}
+		_, _, manifest := src.Manifest()
+		for _, blob := range append([]descriptor{manifest.Config}, manifest.Layers...) {
+			checkBlob(blob)
+		}
+	}
+	fmt.Printf("Checked %d manifests and %d blobs in OCI layout\n", len(refs), len(checked))
+	return problems
+}
+
+// verifyBlobFile 重新计算 blobs/ 下文件的摘要
+func verifyBlobFile(dir string, blob descriptor) error {
+	filePath := filepath.Join(dir, filepath.FromSlash(blobPath(blob.Digest)))
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("missing blob %s: %w", blob.Digest, err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return fmt.Errorf("cannot read blob %s: %w", blob.Digest, err)
+	}
+	if got := "sha256:" + hex.EncodeToString(hasher.Sum(nil)); got != blob.Digest || size != blob.Size {
+		return fmt.Errorf("blob %s is corrupted: got %s (%d bytes), expected %d bytes", blob.Digest, got, size, blob.Size)
+	}
+	return nil
+}
+
+// findPartialFiles 查找中断后遗留的 .partial 文件
+func findPartialFiles(dir string) ([]string, error) {
+	var partials []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".partial") {
+			partials = append(partials, path)
+		}
+		return nil
+	})
+	return partials, err
+}
+
+// verifyDrift 对比备份时刻的 URI 列表与 Harbor 当前的 non_unknown_arch_uris
+func verifyDrift(ctx context.Context, client *harbor.Client, backupURIs []string) ([]string, error) {
+	artifactURIs, err := fetchAllArtifactsWithTypes(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching artifacts: %w", err)
+	}
+	currentURIs := artifactURIs["non_unknown_arch_uris"]
+
+	var problems []string
+	for _, uri := range findNewOrChangedURIs(currentURIs, backupURIs) {
+		problems = append(problems, fmt.Sprintf("drift: %s is in Harbor but not in the backup", uri))
+	}
+	for _, uri := range findNewOrChangedURIs(backupURIs, currentURIs) {
+		problems = append(problems, fmt.Sprintf("drift: %s is in the backup but no longer in Harbor", uri))
+	}
+	fmt.Printf("Compared %d backed up URIs with %d URIs in Harbor\n", len(backupURIs), len(currentURIs))
+	return problems, nil
+}
+
+// printVerifyProblems 打印校验发现的问题
+func printVerifyProblems(problems []string) {
+	fmt.Printf("Found %d problems:\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("- %s\n", problem)
+	}
+}